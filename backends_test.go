@@ -0,0 +1,290 @@
+package glox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// options are what a test sets on the backend running its program
+type options struct {
+	Globals      map[string]Value
+	Stdout       io.Writer
+	Stdin        io.Reader
+	Context      context.Context
+	StepBudget   int
+	MaxCallDepth int
+}
+
+// backends run a parsed program set up with opts
+var backends = []struct {
+	name string
+	run  func(stmts []Stmt, opts options) error
+}{
+	{"tree", func(stmts []Stmt, opts options) error {
+		interpreter := &Interpreter{
+			Globals:      opts.Globals,
+			Stdout:       opts.Stdout,
+			Stdin:        opts.Stdin,
+			Context:      opts.Context,
+			StepBudget:   opts.StepBudget,
+			MaxCallDepth: opts.MaxCallDepth,
+		}
+		resolver := Resolver{
+			Interpreter: interpreter,
+		}
+		if err := resolver.Resolve(stmts); err != nil {
+			return err
+		}
+		return interpreter.Interpret(stmts)
+	}},
+	{"closure", func(stmts []Stmt, opts options) error {
+		interpreter := &ClosureInterpreter{
+			Globals:      opts.Globals,
+			Stdout:       opts.Stdout,
+			Stdin:        opts.Stdin,
+			Context:      opts.Context,
+			StepBudget:   opts.StepBudget,
+			MaxCallDepth: opts.MaxCallDepth,
+		}
+		return interpreter.Interpret(stmts)
+	}},
+	{"vm", func(stmts []Stmt, opts options) error {
+		function, err := Compile(stmts)
+		if err != nil {
+			return err
+		}
+		vm := &VM{
+			Globals:      opts.Globals,
+			Stdout:       opts.Stdout,
+			Stdin:        opts.Stdin,
+			Context:      opts.Context,
+			StepBudget:   opts.StepBudget,
+			MaxCallDepth: opts.MaxCallDepth,
+		}
+		return vm.Interpret(function)
+	}},
+}
+
+func parse(tb testing.TB, source string) []Stmt {
+	tb.Helper()
+	scanner := Scanner{
+		Source: source,
+	}
+	parser := Parser{
+		Tokens: scanner.ScanTokens(),
+	}
+	stmts, err := parser.Parse()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if len(scanner.Errors) > 0 {
+		tb.Fatal(ParseErrors(scanner.Errors))
+	}
+	return stmts
+}
+
+var programs = []struct {
+	name   string
+	source string
+	stdout string
+	line   int // Line of the runtime error the program stops with, if any
+}{
+	{"arithmetic", `
+print 1 + 2 * 3;
+print (1 + 2) * 3;
+print 2 ** 10;
+print "a" + "b";
+print !nil == true;
+`, "7\n9\n1024\nab\ntrue\n", 0},
+	{"deep recursion", `
+fun sum(n) {
+  if (n == 0) return 0;
+  return n + sum(n - 1);
+}
+print sum(1000);
+print sum(5000);
+`, "500500\n12502500\n", 0},
+	{"fib", `
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 1) + fib(n - 2);
+}
+print fib(15);
+`, "610\n", 0},
+	{"closures", `
+fun counter() {
+  var n = 0;
+  fun inc() {
+    n = n + 1;
+    return n;
+  }
+  return inc;
+}
+var a = counter();
+var b = counter();
+a();
+a();
+print a();
+print b();
+`, "3\n1\n", 0},
+	{"shared upvalue", `
+var get;
+var set;
+fun make() {
+  var x = "before";
+  fun g() { return x; }
+  fun s(value) { x = value; }
+  get = g;
+  set = s;
+}
+make();
+set("after");
+print get();
+`, "after\n", 0},
+	{"upvalue closed in loop", `
+var fs;
+for (var i = 0; i < 3; i = i + 1) {
+  var j = i;
+  fun f() { return j; }
+  if (i == 1) fs = f;
+}
+print fs();
+`, "1\n", 0},
+	{"upvalue through deep recursion", `
+fun make(n) {
+  var x = n;
+  fun get() { return x; }
+  if (n == 0) return get;
+  var inner = make(n - 1);
+  x = x + inner();
+  return get;
+}
+print make(500)();
+`, "125250\n", 0},
+	{"classes", `
+class Point {
+  init(x, y) {
+    this.x = x;
+    this.y = y;
+  }
+  add(other) {
+    return Point(this.x + other.x, this.y + other.y);
+  }
+}
+var p = Point(1, 2).add(Point(3, 4));
+print p.x;
+print p.y;
+var add = p.add;
+print add(p).x;
+`, "4\n6\n8\n", 0},
+	{"super", `
+class A {
+  name() { return "A"; }
+  greet() { return "hello from " + this.name(); }
+}
+class B < A {
+  name() { return "B"; }
+  greet() { return super.greet() + " via " + super.name(); }
+}
+print B().greet();
+`, "hello from B via A\n", 0},
+	{"captured this, super and parameters", `
+class A {
+  name() { return "A"; }
+}
+class B < A {
+  init(greeting) {
+    this.greeting = greeting;
+  }
+  greeter(punctuation) {
+    fun greet() { return this.greeting + " " + super.name() + punctuation; }
+    return greet;
+  }
+}
+var greet = B("hi").greeter("!");
+print greet();
+`, "hi A!\n", 0},
+	{"undefined variable", `
+print "before";
+
+print nope;
+`, "before\n", 4},
+	{"bad operand", `
+var a = 1;
+var b = "b";
+print a - b;
+`, "", 4},
+	{"error in a call", `
+fun f(x) {
+  return x.field;
+}
+print "start";
+f(1);
+`, "start\n", 3},
+	{"wrong arity", `
+fun f(a, b) {}
+f(1);
+`, "", 3},
+}
+
+func TestBackends(t *testing.T) {
+	for _, program := range programs {
+		for _, backend := range backends {
+			t.Run(program.name+"/"+backend.name, func(t *testing.T) {
+				var stdout bytes.Buffer
+				err := backend.run(parse(t, program.source), options{Stdout: &stdout})
+
+				if got := stdout.String(); got != program.stdout {
+					t.Errorf("printed %q, want %q", got, program.stdout)
+				}
+
+				if program.line == 0 {
+					if err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+					return
+				}
+
+				var runtimeErr RuntimeError
+				if !errors.As(err, &runtimeErr) {
+					t.Fatalf("got error %v, want a runtime error", err)
+				}
+				if runtimeErr.Token.Line != program.line {
+					t.Errorf("got error %v, want it on line %d", err, program.line)
+				}
+			})
+		}
+	}
+}
+
+func TestNativeErrors(t *testing.T) {
+	stmts := parse(t, `
+print "start";
+fail();
+`)
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			// A runtime error from a native, say from Lox code it called
+			// back into, keeps its token rather than getting the call's
+			globals := map[string]Value{
+				"fail": ObjectValue(&NativeFunction{
+					Name: "fail",
+					Function: func(intr *Interpreter, args []Value) (Value, error) {
+						return NilValue, RuntimeError{Token{Lexeme: "x", Line: 7}, "failed"}
+					},
+				}),
+			}
+
+			var stdout bytes.Buffer
+			err := backend.run(stmts, options{Globals: globals, Stdout: &stdout})
+			want := `runtime error on line 7 at "x": failed`
+			if err == nil || err.Error() != want {
+				t.Errorf("got error %v, want %s", err, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package glox
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+// benchmark times each backend running source
+func benchmark(b *testing.B, source string) {
+	stmts := parse(b, source)
+	for _, backend := range backends {
+		b.Run(backend.name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				if err := backend.run(stmts, options{Stdout: ioutil.Discard}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFib(b *testing.B) {
+	benchmark(b, `
+fun fib(n) {
+  if (n < 2) return n;
+  return fib(n - 1) + fib(n - 2);
+}
+fib(20);
+`)
+}
+
+func BenchmarkLoop(b *testing.B) {
+	benchmark(b, `
+var sum = 0;
+for (var i = 0; i < 100000; i = i + 1) {
+  sum = sum + i;
+}
+`)
+}
+
+func BenchmarkClosures(b *testing.B) {
+	benchmark(b, `
+fun counter() {
+  var n = 0;
+  fun inc() {
+    n = n + 1;
+    return n;
+  }
+  return inc;
+}
+var c = counter();
+for (var i = 0; i < 20000; i = i + 1) c();
+`)
+}
+
+func BenchmarkMethods(b *testing.B) {
+	benchmark(b, `
+class Point {
+  init(x, y) {
+    this.x = x;
+    this.y = y;
+  }
+  add(other) {
+    return Point(this.x + other.x, this.y + other.y);
+  }
+}
+var p = Point(0, 0);
+for (var i = 0; i < 10000; i = i + 1) p = p.add(Point(1, 1));
+`)
+}
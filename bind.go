@@ -0,0 +1,560 @@
+package glox
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PropertyObject is an Object with properties that Lox code can read and
+// set with dot syntax, the same as the fields of an instance
+type PropertyObject interface {
+	Object
+	GetProperty(name string) (Value, error)
+	SetProperty(name string, value Value) error
+}
+
+var (
+	valueType = reflect.TypeOf(Value{})
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Bind converts value with ValueOf and defines it as the global name
+func (rt *Runtime) Bind(name string, value interface{}) error {
+	converted, err := rt.ValueOf(value)
+	if err != nil {
+		return err
+	}
+	rt.Define(name, converted)
+	return nil
+}
+
+// ValueOf converts a Go value into a Lox one using reflection. Booleans,
+// numbers and strings become their Lox equivalents and nil pointers, slices
+// and maps become nil. Functions become native functions, which convert
+// their arguments from Lox and their result back, and whose error result, if
+// they have one, stops the script with a runtime error. Pointers to structs
+// become objects whose properties are the struct's exported fields and
+// methods, with the first letter capitalized if need be, so p.name finds
+// Name. Slices, arrays and maps become objects with methods to work on them:
+// len, get, set and append for slices and arrays, and len, get, set, has,
+// delete and keys for maps
+func (rt *Runtime) ValueOf(value interface{}) (Value, error) {
+	rt.init()
+	return toValue(&rt.interpreter, reflect.ValueOf(value))
+}
+
+// toValue converts a Go value into a Lox one, intr is used to call any Lox
+// functions later passed back to Go
+func toValue(intr *Interpreter, v reflect.Value) (Value, error) {
+	if !v.IsValid() {
+		return NilValue, nil
+	}
+	if v.Type() == valueType {
+		return v.Interface().(Value), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return BoolValue(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NumberValue(float64(v.Int())), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return NumberValue(float64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return NumberValue(v.Float()), nil
+	case reflect.String:
+		return StringValue(v.String()), nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return NilValue, nil
+		}
+		return toValue(intr, v.Elem())
+	case reflect.Func:
+		if v.IsNil() {
+			return NilValue, nil
+		}
+		return bindFunc(intr, "", v)
+	case reflect.Ptr:
+		if v.IsNil() {
+			return NilValue, nil
+		}
+		if v.Elem().Kind() == reflect.Struct {
+			return ObjectValue(goStruct{v.Interface(), intr}), nil
+		}
+		return toValue(intr, v.Elem())
+	case reflect.Struct:
+		// Structs that can't be changed where they are, such as those
+		// passed by value, are copied
+		if !v.CanAddr() {
+			copied := reflect.New(v.Type())
+			copied.Elem().Set(v)
+			v = copied.Elem()
+		}
+		return ObjectValue(goStruct{v.Addr().Interface(), intr}), nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NilValue, nil
+		}
+		return ObjectValue(&goList{v, intr}), nil
+	case reflect.Map:
+		if v.IsNil() {
+			return NilValue, nil
+		}
+		return ObjectValue(&goMap{v, intr}), nil
+	}
+
+	return NilValue, fmt.Errorf("can't convert %s to a Lox value", v.Type())
+}
+
+// fromValue converts a Lox value into a Go value of type t
+func fromValue(intr *Interpreter, value Value, t reflect.Type) (reflect.Value, error) {
+	if t == valueType {
+		return reflect.ValueOf(value), nil
+	}
+
+	mismatch := fmt.Errorf("expected %s but got %s", t, describe(value))
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if value.Type() != VAL_BOOL {
+			return reflect.Value{}, mismatch
+		}
+		return reflect.ValueOf(value.AsBool()).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Converting a float out of the range of int64, infinities
+		// included, gives an unspecified result so check it first
+		n := value.AsNumber()
+		if !value.IsNumber() || n != math.Trunc(n) || n < math.MinInt64 || n >= math.MaxInt64 || reflect.Zero(t).OverflowInt(int64(n)) {
+			return reflect.Value{}, mismatch
+		}
+		return reflect.ValueOf(int64(n)).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n := value.AsNumber()
+		if !value.IsNumber() || n != math.Trunc(n) || n < 0 || n >= math.MaxUint64 || reflect.Zero(t).OverflowUint(uint64(n)) {
+			return reflect.Value{}, mismatch
+		}
+		return reflect.ValueOf(uint64(n)).Convert(t), nil
+	case reflect.Float32, reflect.Float64:
+		if !value.IsNumber() {
+			return reflect.Value{}, mismatch
+		}
+		return reflect.ValueOf(value.AsNumber()).Convert(t), nil
+	case reflect.String:
+		if !value.IsString() {
+			return reflect.Value{}, mismatch
+		}
+		return reflect.ValueOf(value.AsString()).Convert(t), nil
+	case reflect.Func:
+		if value.IsNil() {
+			return reflect.Zero(t), nil
+		}
+		if callable, isCallable := value.AsObject().(LoxCallable); isCallable {
+			return callbackFunc(intr, callable, t)
+		}
+		return reflect.Value{}, mismatch
+	}
+
+	if value.IsNil() {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, mismatch
+	}
+
+	goValue := reflect.ValueOf(goInterface(value))
+	if goValue.Type().AssignableTo(t) {
+		return goValue, nil
+	}
+	// Structs are held by pointer but can be passed by value
+	if goValue.Kind() == reflect.Ptr && goValue.Elem().Type().AssignableTo(t) {
+		return goValue.Elem(), nil
+	}
+	return reflect.Value{}, mismatch
+}
+
+// goInterface returns the Go value closest to value: a bool, float64 or
+// string, the Go value behind a struct, slice or map object, or for any
+// other object the Value itself
+func goInterface(value Value) interface{} {
+	switch value.Type() {
+	case VAL_NIL:
+		return nil
+	case VAL_BOOL:
+		return value.AsBool()
+	case VAL_NUMBER:
+		return value.AsNumber()
+	case VAL_STRING:
+		return value.AsString()
+	}
+
+	switch obj := value.AsObject().(type) {
+	case goStruct:
+		return obj.ptr
+	case *goList:
+		return obj.value.Interface()
+	case *goMap:
+		return obj.value.Interface()
+	}
+	return value
+}
+
+// describe names the type of value for error messages
+func describe(value Value) string {
+	switch value.Type() {
+	case VAL_NIL:
+		return "nil"
+	case VAL_BOOL:
+		return "a boolean"
+	case VAL_NUMBER:
+		return "a number"
+	case VAL_STRING:
+		return "a string"
+	}
+	return value.String()
+}
+
+// funcResults checks t returns at most one value, optionally followed by an
+// error, and returns how many values it returns not counting the error
+func funcResults(t reflect.Type) (int, bool, error) {
+	if t.IsVariadic() {
+		return 0, false, errors.New("variadic functions can't be used from Lox")
+	}
+
+	results := t.NumOut()
+	returnsError := results > 0 && t.Out(results-1) == errorType
+	if returnsError {
+		results--
+	}
+	if results > 1 {
+		return 0, false, fmt.Errorf("%s returns more than one value", t)
+	}
+	return results, returnsError, nil
+}
+
+// bindFunc wraps the Go function fn in a NativeFunction
+func bindFunc(intr *Interpreter, name string, fn reflect.Value) (Value, error) {
+	t := fn.Type()
+	results, returnsError, err := funcResults(t)
+	if err != nil {
+		return NilValue, err
+	}
+
+	return ObjectValue(&NativeFunction{
+		Name:   name,
+		Params: t.NumIn(),
+		Function: func(_ *Interpreter, args []Value) (Value, error) {
+			in := make([]reflect.Value, len(args))
+			for i, arg := range args {
+				converted, err := fromValue(intr, arg, t.In(i))
+				if err != nil {
+					return NilValue, fmt.Errorf("argument %d: %v", i+1, err)
+				}
+				in[i] = converted
+			}
+
+			out := fn.Call(in)
+			if returnsError && !out[len(out)-1].IsNil() {
+				return NilValue, out[len(out)-1].Interface().(error)
+			}
+			if results == 0 {
+				return NilValue, nil
+			}
+			return toValue(intr, out[0])
+		},
+	}), nil
+}
+
+// callbackFunc makes a Go function of type t that calls the Lox function
+// callable. If t returns an error a runtime error in callable, or a value it
+// can't convert, is returned as it is for the Lox call that led here to put
+// its token on. Otherwise it's raised in the Lox code that called back into Go
+func callbackFunc(intr *Interpreter, callable LoxCallable, t reflect.Type) (reflect.Value, error) {
+	results, returnsError, err := funcResults(t)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	if callable.Arity() != t.NumIn() {
+		return reflect.Value{}, fmt.Errorf("expected a function of %d arguments but got %s", t.NumIn(), callable)
+	}
+
+	return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+		out := make([]reflect.Value, t.NumOut())
+		for i := range out {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+
+		var err error
+		func() {
+			if returnsError {
+				defer recoverRuntimeError(&err)
+			}
+
+			args := make([]Value, len(in))
+			for i, arg := range in {
+				var converted Value
+				converted, err = toValue(intr, arg)
+				if err != nil {
+					return
+				}
+				args[i] = converted
+			}
+
+			result := callable.Call(intr, args)
+			if results == 0 {
+				return
+			}
+
+			var converted reflect.Value
+			converted, err = fromValue(intr, result, t.Out(0))
+			if err != nil {
+				return
+			}
+			out[0] = converted
+		}()
+
+		if err != nil {
+			if !returnsError {
+				panic(RuntimeError{Message: err.Error()})
+			}
+			out[len(out)-1] = reflect.ValueOf(&err).Elem()
+		}
+		return out
+	}), nil
+}
+
+// goStruct is a pointer to a Go struct
+type goStruct struct {
+	ptr  interface{}
+	intr *Interpreter
+}
+
+// goNames returns the Go names a Lox property name could refer to
+func goNames(name string) []string {
+	first, size := utf8.DecodeRuneInString(name)
+	if unicode.IsUpper(first) {
+		return []string{name}
+	}
+	return []string{name, string(unicode.ToUpper(first)) + name[size:]}
+}
+
+func (obj goStruct) GetProperty(name string) (Value, error) {
+	ptr := reflect.ValueOf(obj.ptr)
+	for _, goName := range goNames(name) {
+		if field, exists := ptr.Elem().Type().FieldByName(goName); exists && field.PkgPath == "" {
+			return toValue(obj.intr, ptr.Elem().FieldByIndex(field.Index))
+		}
+		if method := ptr.MethodByName(goName); method.IsValid() {
+			return bindFunc(obj.intr, goName, method)
+		}
+	}
+	return NilValue, fmt.Errorf("undefined property '%s'", name)
+}
+
+func (obj goStruct) SetProperty(name string, value Value) error {
+	ptr := reflect.ValueOf(obj.ptr)
+	for _, goName := range goNames(name) {
+		if field, exists := ptr.Elem().Type().FieldByName(goName); exists && field.PkgPath == "" {
+			converted, err := fromValue(obj.intr, value, field.Type)
+			if err != nil {
+				return fmt.Errorf("can't set %s: %v", name, err)
+			}
+			ptr.Elem().FieldByIndex(field.Index).Set(converted)
+			return nil
+		}
+	}
+	return fmt.Errorf("undefined field '%s'", name)
+}
+
+func (obj goStruct) String() string {
+	if stringer, isStringer := obj.ptr.(fmt.Stringer); isStringer {
+		return stringer.String()
+	}
+	return fmt.Sprintf("<%T>", obj.ptr)
+}
+
+// goList is a Go slice or array
+type goList struct {
+	value reflect.Value
+	intr  *Interpreter
+}
+
+// index converts a Lox number to an index into the list
+func (list *goList) index(value Value) (int, error) {
+	n := value.AsNumber()
+	if !value.IsNumber() || n != math.Trunc(n) || n < 0 || n >= float64(list.value.Len()) {
+		return 0, fmt.Errorf("index %s out of range", value)
+	}
+	return int(n), nil
+}
+
+func (list *goList) GetProperty(name string) (Value, error) {
+	var method func(args []Value) (Value, error)
+	params := 1
+
+	switch name {
+	case "len":
+		params = 0
+		method = func(args []Value) (Value, error) {
+			return NumberValue(float64(list.value.Len())), nil
+		}
+	case "get":
+		method = func(args []Value) (Value, error) {
+			i, err := list.index(args[0])
+			if err != nil {
+				return NilValue, err
+			}
+			return toValue(list.intr, list.value.Index(i))
+		}
+	case "set":
+		params = 2
+		method = func(args []Value) (Value, error) {
+			i, err := list.index(args[0])
+			if err != nil {
+				return NilValue, err
+			}
+			if !list.value.Index(i).CanSet() {
+				return NilValue, errors.New("can't change an array passed by value")
+			}
+			element, err := fromValue(list.intr, args[1], list.value.Type().Elem())
+			if err != nil {
+				return NilValue, err
+			}
+			list.value.Index(i).Set(element)
+			return args[1], nil
+		}
+	case "append":
+		method = func(args []Value) (Value, error) {
+			if list.value.Kind() != reflect.Slice {
+				return NilValue, errors.New("can't append to an array")
+			}
+			element, err := fromValue(list.intr, args[0], list.value.Type().Elem())
+			if err != nil {
+				return NilValue, err
+			}
+			appended := reflect.Append(list.value, element)
+			// Update the slice in place if it came from a struct field
+			if list.value.CanSet() {
+				list.value.Set(appended)
+			} else {
+				list.value = appended
+			}
+			return args[0], nil
+		}
+	default:
+		return NilValue, fmt.Errorf("undefined property '%s'", name)
+	}
+
+	return ObjectValue(&NativeFunction{
+		Name:   name,
+		Params: params,
+		Function: func(_ *Interpreter, args []Value) (Value, error) {
+			return method(args)
+		},
+	}), nil
+}
+
+func (list *goList) SetProperty(name string, value Value) error {
+	return fmt.Errorf("can't set properties on a Go %s", list.value.Kind())
+}
+
+func (list *goList) String() string {
+	return fmt.Sprint(list.value.Interface())
+}
+
+// goMap is a Go map
+type goMap struct {
+	value reflect.Value
+	intr  *Interpreter
+}
+
+func (m *goMap) key(value Value) (reflect.Value, error) {
+	return fromValue(m.intr, value, m.value.Type().Key())
+}
+
+func (m *goMap) GetProperty(name string) (Value, error) {
+	var method func(args []Value) (Value, error)
+	params := 1
+
+	switch name {
+	case "len":
+		params = 0
+		method = func(args []Value) (Value, error) {
+			return NumberValue(float64(m.value.Len())), nil
+		}
+	case "get":
+		method = func(args []Value) (Value, error) {
+			key, err := m.key(args[0])
+			if err != nil {
+				return NilValue, err
+			}
+			return toValue(m.intr, m.value.MapIndex(key))
+		}
+	case "has":
+		method = func(args []Value) (Value, error) {
+			key, err := m.key(args[0])
+			if err != nil {
+				return NilValue, err
+			}
+			return BoolValue(m.value.MapIndex(key).IsValid()), nil
+		}
+	case "set":
+		params = 2
+		method = func(args []Value) (Value, error) {
+			key, err := m.key(args[0])
+			if err != nil {
+				return NilValue, err
+			}
+			element, err := fromValue(m.intr, args[1], m.value.Type().Elem())
+			if err != nil {
+				return NilValue, err
+			}
+			m.value.SetMapIndex(key, element)
+			return args[1], nil
+		}
+	case "delete":
+		method = func(args []Value) (Value, error) {
+			key, err := m.key(args[0])
+			if err != nil {
+				return NilValue, err
+			}
+			m.value.SetMapIndex(key, reflect.Value{})
+			return NilValue, nil
+		}
+	case "keys":
+		params = 0
+		method = func(args []Value) (Value, error) {
+			keys := m.value.MapKeys()
+			sort.Slice(keys, func(i, j int) bool {
+				return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+			})
+
+			slice := reflect.MakeSlice(reflect.SliceOf(m.value.Type().Key()), 0, len(keys))
+			slice = reflect.Append(slice, keys...)
+			return ObjectValue(&goList{slice, m.intr}), nil
+		}
+	default:
+		return NilValue, fmt.Errorf("undefined property '%s'", name)
+	}
+
+	return ObjectValue(&NativeFunction{
+		Name:   name,
+		Params: params,
+		Function: func(_ *Interpreter, args []Value) (Value, error) {
+			return method(args)
+		},
+	}), nil
+}
+
+func (m *goMap) SetProperty(name string, value Value) error {
+	return errors.New("can't set properties on a Go map")
+}
+
+func (m *goMap) String() string {
+	return fmt.Sprint(m.value.Interface())
+}
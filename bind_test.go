@@ -0,0 +1,67 @@
+package glox
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFromValueIntegerRange(t *testing.T) {
+	tests := []struct {
+		n         float64
+		int, uint bool // Whether n converts to an int64 and a uint64
+	}{
+		{42, true, true},
+		{-1, true, false},
+		{0.5, false, false},
+		{math.MinInt64, true, false},
+		{math.MaxInt64, false, true},
+		{math.MaxUint64, false, false},
+		{1e20, false, false},
+		{math.Inf(1), false, false},
+		{math.Inf(-1), false, false},
+		{math.NaN(), false, false},
+	}
+
+	for _, test := range tests {
+		_, err := fromValue(nil, NumberValue(test.n), reflect.TypeOf(int64(0)))
+		if (err == nil) != test.int {
+			t.Errorf("converting %v to int64 gave error %v", test.n, err)
+		}
+		_, err = fromValue(nil, NumberValue(test.n), reflect.TypeOf(uint64(0)))
+		if (err == nil) != test.uint {
+			t.Errorf("converting %v to uint64 gave error %v", test.n, err)
+		}
+	}
+}
+
+func TestCallbackErrors(t *testing.T) {
+	rt := Runtime{}
+	rt.Bind("apply", func(f func(float64) (int, error)) (int, error) {
+		return f(1)
+	})
+
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{
+			`fun f(x) { return "x"; }
+print apply(f);`,
+			`runtime error on line 2 at ")": expected int but got a string`,
+		},
+		{
+			`fun f(x) {
+  return x + nil;
+}
+print apply(f);`,
+			`runtime error on line 2 at "+": operands must be two numbers or two strings`,
+		},
+	}
+
+	for _, test := range tests {
+		if err := rt.Run(test.source); err == nil || err.Error() != test.err {
+			t.Errorf("got error %v, want %s", err, test.err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package glox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrBudgetExceeded is returned when a program takes more steps than its
+// interpreter's StepBudget allows
+var ErrBudgetExceeded = errors.New("step budget exceeded")
+
+// defaultMaxCallDepth is how deeply calls can nest if no MaxCallDepth is
+// given, deep enough for any sensible recursion but well short of running
+// out of Go stack
+const defaultMaxCallDepth = 10000
+
+// Rough sizes in bytes of what a program allocates, counted against its
+// MaxAllocation
+const (
+	stringSize   = 16 // Plus a byte for each character
+	instanceSize = 64
+	fieldSize    = 48
+)
+
+// stopError is raised to stop a program that has run out of budget, gone
+// over a limit or been cancelled. Unlike a RuntimeError it's only recovered
+// where Go called into Lox, so it's returned as it is rather than as a
+// runtime error that Go code along the way might handle
+type stopError struct {
+	err error
+}
+
+// budget counts the steps a program takes, every loop iteration and
+// function call, how deeply its calls are nested and how much it allocates,
+// and stops it when it goes over its limits or its context is done
+type budget struct {
+	ctx   context.Context
+	limit int
+	steps int
+
+	maxDepth int
+	depth    int
+
+	maxAllocation int
+	allocated     int
+}
+
+// newBudget returns the budget for a program, limits of 0 leave it
+// unlimited except for the call depth which gets a default
+func newBudget(ctx context.Context, steps, maxDepth, maxAllocation int) *budget {
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxCallDepth
+	}
+	return &budget{
+		ctx:           ctx,
+		limit:         steps,
+		maxDepth:      maxDepth,
+		maxAllocation: maxAllocation,
+	}
+}
+
+// step counts a step. Like the rest of the methods it does nothing on a nil
+// budget, which is what code run outside of a program has
+func (b *budget) step() {
+	if b == nil {
+		return
+	}
+
+	b.steps++
+	if b.limit > 0 && b.steps > b.limit {
+		panic(stopError{ErrBudgetExceeded})
+	}
+
+	if b.ctx != nil {
+		select {
+		case <-b.ctx.Done():
+			panic(stopError{b.ctx.Err()})
+		default:
+		}
+	}
+}
+
+// enter is called at the start of a call made at paren, leave when it's finished
+func (b *budget) enter(paren Token) {
+	if b == nil {
+		return
+	}
+
+	if b.depth >= b.maxDepth {
+		panic(stopError{StackOverflowError{RuntimeError{paren, "stack overflow"}}})
+	}
+	b.depth++
+}
+
+func (b *budget) leave() {
+	if b == nil {
+		return
+	}
+	b.depth--
+}
+
+// allocate counts size bytes allocated by the code at token
+func (b *budget) allocate(token Token, size int) {
+	if b == nil || b.maxAllocation <= 0 {
+		return
+	}
+
+	b.allocated += size
+	if b.allocated > b.maxAllocation {
+		message := fmt.Sprintf("allocation limit of %d bytes exceeded", b.maxAllocation)
+		panic(stopError{AllocationError{RuntimeError{token, message}, b.allocated}})
+	}
+}
@@ -0,0 +1,126 @@
+package glox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStackOverflow(t *testing.T) {
+	stmts := parse(t, `
+fun f(n) {
+  print n;
+  f(n + 1);
+}
+f(1);
+`)
+
+	for _, maxCallDepth := range []int{1, 10, 255, 256, 1000, 0} {
+		want := maxCallDepth
+		if want == 0 {
+			want = defaultMaxCallDepth
+		}
+
+		for _, backend := range backends {
+			t.Run(strconv.Itoa(maxCallDepth)+"/"+backend.name, func(t *testing.T) {
+				var stdout bytes.Buffer
+				err := backend.run(stmts, options{Stdout: &stdout, MaxCallDepth: maxCallDepth})
+
+				var overflow StackOverflowError
+				if !errors.As(err, &overflow) {
+					t.Fatalf("got error %v, want a StackOverflowError", err)
+				}
+
+				lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+				if depth, _ := strconv.Atoi(lines[len(lines)-1]); depth != want {
+					t.Errorf("stopped %d calls deep, want %d", depth, want)
+				}
+			})
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name   string
+		source string
+		opts   func() (options, context.CancelFunc)
+		err    error
+	}{
+		{"infinite loop", `while (true) {}`, func() (options, context.CancelFunc) {
+			return options{StepBudget: 1000}, func() {}
+		}, ErrBudgetExceeded},
+		{"unbounded recursion", `fun f() { f(); } f();`, func() (options, context.CancelFunc) {
+			return options{StepBudget: 100}, func() {}
+		}, ErrBudgetExceeded},
+		{"cancelled", `while (true) {}`, func() (options, context.CancelFunc) {
+			return options{Context: cancelled}, func() {}
+		}, context.Canceled},
+		{"timed out", `while (true) {}`, func() (options, context.CancelFunc) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			return options{Context: ctx}, cancel
+		}, context.DeadlineExceeded},
+	}
+
+	for _, test := range tests {
+		stmts := parse(t, test.source)
+		for _, backend := range backends {
+			t.Run(test.name+"/"+backend.name, func(t *testing.T) {
+				opts, cancel := test.opts()
+				defer cancel()
+
+				if err := backend.run(stmts, opts); !errors.Is(err, test.err) {
+					t.Errorf("got error %v, want %v", err, test.err)
+				}
+			})
+		}
+	}
+}
+
+func TestRuntimeCallLimits(t *testing.T) {
+	rt := Runtime{
+		StepBudget: 1000,
+	}
+	if err := rt.Run(`fun spin() { while (true) {} }`); err != nil {
+		t.Fatal(err)
+	}
+
+	spin, _ := rt.Get("spin")
+	if _, err := rt.Call(spin); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("got error %v, want %v", err, ErrBudgetExceeded)
+	}
+
+	// Each call gets a budget of its own
+	if err := rt.Run(`var ok = true;`); err != nil {
+		t.Errorf("unexpected error after running out of budget: %v", err)
+	}
+}
+
+func TestCallDepthOfArguments(t *testing.T) {
+	// Calls made evaluating arguments are at the caller's depth, so calls
+	// nested in arguments don't add to it
+	stmts := parse(t, `
+fun f(n) { return n; }
+fun g(n) { return f(n); }
+print g(f(f(f(1))));
+`)
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if err := backend.run(stmts, options{Stdout: &stdout, MaxCallDepth: 2}); err != nil {
+				t.Fatal(err)
+			}
+			if got := stdout.String(); got != "1\n" {
+				t.Errorf("printed %q, want %q", got, "1\n")
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package glox
+
+import "fmt"
+
+// LoxCallable is implemented by every value that can be called from Lox code
+type LoxCallable interface {
+	Arity() int
+	Call(intr *Interpreter, args []Value) Value
+}
+
+// LoxFunction is a user defined function along with the environment it was declared in
+type LoxFunction struct {
+	Declaration   Function
+	Closure       *Environment
+	IsInitializer bool
+}
+
+// Arity returns the number of parameters the function expects
+func (fn *LoxFunction) Arity() int {
+	return len(fn.Declaration.Params)
+}
+
+// Call runs the function body in a new environment enclosed by the
+// function's closure, the parameters take the first slots. They're a copy
+// of args, which the body's locals are appended to
+func (fn *LoxFunction) Call(intr *Interpreter, args []Value) Value {
+	env := &Environment{
+		Enclosing: fn.Closure,
+		Values:    append([]Value(nil), args...),
+	}
+
+	ret, isReturn := intr.executeBlock(fn.Declaration.Body, env).(returnValue)
+
+	if fn.IsInitializer {
+		return fn.Closure.Values[0]
+	}
+
+	if isReturn {
+		return ret.Value
+	}
+
+	return NilValue
+}
+
+// Bind returns a copy of the function with this bound to instance
+func (fn *LoxFunction) Bind(instance *LoxInstance) *LoxFunction {
+	env := &Environment{Enclosing: fn.Closure}
+	env.define(ObjectValue(instance))
+
+	return &LoxFunction{
+		Declaration:   fn.Declaration,
+		Closure:       env,
+		IsInitializer: fn.IsInitializer,
+	}
+}
+
+func (fn *LoxFunction) String() string {
+	return fmt.Sprintf("<fn %s>", fn.Declaration.Name.Lexeme)
+}
+
+// returnValue is passed back up through the statement visitors when a return statement is executed
+type returnValue struct {
+	Value Value
+}
+
+// NativeFunction is a function written in Go that can be called from Lox.
+// When it's called by the bytecode VM or closure compiler intr only has the
+// streams and Reporter set. An error returned by Function stops the program
+// with a runtime error
+type NativeFunction struct {
+	Name     string
+	Params   int
+	Function func(intr *Interpreter, args []Value) (Value, error)
+}
+
+// Arity returns the number of parameters the function expects
+func (fn *NativeFunction) Arity() int {
+	return fn.Params
+}
+
+// Call runs the Go function, raising any error it returns as a RuntimeError
+func (fn *NativeFunction) Call(intr *Interpreter, args []Value) Value {
+	value, err := fn.Function(intr, args)
+	if err != nil {
+		panic(nativeError(Token{}, err))
+	}
+	return value
+}
+
+func (fn *NativeFunction) String() string {
+	return "<native fn>"
+}
@@ -0,0 +1,85 @@
+package glox
+
+import "fmt"
+
+// Opcodes understood by the VM. Operands follow the opcode in the chunk, a
+// "short" operand is two bytes, high byte first
+const (
+	OP_CONSTANT      = iota // short constant index
+	OP_NIL                  //
+	OP_TRUE                 //
+	OP_FALSE                //
+	OP_POP                  //
+	OP_GET_LOCAL            // byte stack slot
+	OP_SET_LOCAL            // byte stack slot
+	OP_GET_GLOBAL           // short name constant
+	OP_DEFINE_GLOBAL        // short name constant
+	OP_SET_GLOBAL           // short name constant
+	OP_GET_UPVALUE          // byte upvalue index
+	OP_SET_UPVALUE          // byte upvalue index
+	OP_GET_PROPERTY         // short name constant
+	OP_SET_PROPERTY         // short name constant
+	OP_GET_SUPER            // short name constant
+	OP_EQUAL                //
+	OP_GREATER              //
+	OP_GREATER_EQUAL        //
+	OP_LESS                 //
+	OP_LESS_EQUAL           //
+	OP_ADD                  //
+	OP_SUBTRACT             //
+	OP_MULTIPLY             //
+	OP_DIVIDE               //
+	OP_POWER                //
+	OP_NOT                  //
+	OP_NEGATE               //
+	OP_PRINT                //
+	OP_JUMP                 // short forward offset
+	OP_JUMP_IF_FALSE        // short forward offset
+	OP_LOOP                 // short backward offset
+	OP_CALL                 // byte argument count
+	OP_INVOKE               // short name constant, byte argument count
+	OP_SUPER_INVOKE         // short name constant, byte argument count
+	OP_CLOSURE              // short function constant, then a byte pair (is local, index) per upvalue
+	OP_CLOSE_UPVALUE        //
+	OP_RETURN               //
+	OP_CLASS                // short name constant
+	OP_INHERIT              //
+	OP_METHOD               // short name constant
+)
+
+// Chunk is a sequence of bytecode along with the constants it refers to
+type Chunk struct {
+	Code      []byte
+	Lines     []int // Source line of each byte in Code
+	Constants []Value
+}
+
+func (chunk *Chunk) write(b byte, line int) {
+	chunk.Code = append(chunk.Code, b)
+	chunk.Lines = append(chunk.Lines, line)
+}
+
+func (chunk *Chunk) addConstant(value Value) int {
+	chunk.Constants = append(chunk.Constants, value)
+	return len(chunk.Constants) - 1
+}
+
+func (chunk *Chunk) readShort(offset int) int {
+	return int(chunk.Code[offset])<<8 | int(chunk.Code[offset+1])
+}
+
+// CompiledFunction is a function compiled to bytecode. The top level of a
+// script is compiled into a function with no name
+type CompiledFunction struct {
+	Name         string
+	Arity        int
+	UpvalueCount int
+	Chunk        *Chunk
+}
+
+func (fn *CompiledFunction) String() string {
+	if fn.Name == "" {
+		return "<script>"
+	}
+	return fmt.Sprintf("<fn %s>", fn.Name)
+}
@@ -0,0 +1,75 @@
+package glox
+
+import "fmt"
+
+// LoxClass is the runtime representation of a class, calling it creates a new instance
+type LoxClass struct {
+	Name       string
+	Superclass *LoxClass
+	Methods    map[string]*LoxFunction
+}
+
+// findMethod looks up a method on the class, falling back to its superclasses
+func (class *LoxClass) findMethod(name string) *LoxFunction {
+	if method, hasMethod := class.Methods[name]; hasMethod {
+		return method
+	}
+
+	if class.Superclass != nil {
+		return class.Superclass.findMethod(name)
+	}
+
+	return nil
+}
+
+// Arity returns the arity of the class initializer, or 0 if there is none
+func (class *LoxClass) Arity() int {
+	if initializer := class.findMethod("init"); initializer != nil {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+// Call creates a new instance of the class and runs its initializer
+func (class *LoxClass) Call(intr *Interpreter, args []Value) Value {
+	instance := &LoxInstance{Class: class}
+
+	if initializer := class.findMethod("init"); initializer != nil {
+		initializer.Bind(instance).Call(intr, args)
+	}
+
+	return ObjectValue(instance)
+}
+
+func (class *LoxClass) String() string {
+	return class.Name
+}
+
+// LoxInstance is an instance of a class with its own set of fields
+type LoxInstance struct {
+	Class  *LoxClass
+	Fields map[string]Value
+}
+
+func (instance *LoxInstance) get(name Token) (Value, error) {
+	if value, hasField := instance.Fields[name.Lexeme]; hasField {
+		return value, nil
+	}
+
+	if method := instance.Class.findMethod(name.Lexeme); method != nil {
+		return ObjectValue(method.Bind(instance)), nil
+	}
+
+	return NilValue, RuntimeError{name, fmt.Sprintf("undefined property '%s'", name.Lexeme)}
+}
+
+func (instance *LoxInstance) set(name Token, value Value) {
+	if instance.Fields == nil {
+		instance.Fields = make(map[string]Value)
+	}
+	instance.Fields[name.Lexeme] = value
+}
+
+func (instance *LoxInstance) String() string {
+	return instance.Class.Name + " instance"
+}
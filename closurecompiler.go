@@ -0,0 +1,742 @@
+package glox
+
+import (
+	"fmt"
+	"math"
+)
+
+// Where a variable lives, as worked out by the closure compiler
+const (
+	varGlobal  = iota
+	varLocal   // In a slot of the current frame
+	varBoxed   // In a cell in a slot of the current frame
+	varUpvalue // In a cell captured by the current closure
+)
+
+type varRef struct {
+	kind   int
+	index  int
+	global *global
+}
+
+// closureLocal is a local variable of the function being compiled, its slot
+// is its index in the function's list of locals
+type closureLocal struct {
+	name  string
+	decl  int // ID of the node that declared it, used to remember whether it's captured
+	depth int
+}
+
+// closureState is the closure compiler's view of the function currently being compiled
+type closureState struct {
+	enclosing  *closureState
+	locals     []closureLocal
+	upvalues   []upvalueRef
+	scopeDepth int
+	slotCount  int
+	hasCells   bool
+}
+
+// closureCompiler turns a syntax tree into Go closures for the ClosureInterpreter
+type closureCompiler struct {
+	current *closureState
+	global  func(name string) *global
+	streams *Interpreter // Holds the streams print writes to and natives are given
+	budget  *budget
+
+	// captured holds the IDs of the declarations of the locals that a
+	// nested function captures. A local has to be boxed from the start,
+	// before the function that captures it has been seen, so the compiler
+	// makes two passes over the program and the first one only fills this in
+	captured map[int]bool
+}
+
+// compileClosures compiles a program into the function for its top level
+func compileClosures(stmts []Stmt, global func(name string) *global, streams *Interpreter, b *budget) *closureProto {
+	c := &closureCompiler{
+		global:   global,
+		streams:  streams,
+		budget:   b,
+		captured: make(map[int]bool),
+	}
+
+	var script *closureProto
+	for pass := 0; pass < 2; pass++ {
+		c.current = &closureState{}
+		script = &closureProto{
+			body: c.compileStmts(stmts),
+		}
+		script.slotCount = c.current.slotCount
+		script.hasCells = c.current.hasCells
+	}
+	return script
+}
+
+func (c *closureCompiler) VisitBlockStmt(stmt Block) interface{} {
+	c.beginScope()
+	body := c.compileStmts(stmt.Statements)
+	c.endScope()
+	return body
+}
+
+func (c *closureCompiler) VisitClassStmt(stmt Class) interface{} {
+	variable := c.declare(stmt.Name, stmt.ID)
+	name := stmt.Name.Lexeme
+
+	var superclass exprFn
+	var superVar varRef
+	if stmt.Superclass != nil {
+		superclass = c.compileExpr(*stmt.Superclass)
+
+		c.beginScope()
+		// super is declared by the superclass clause
+		superVar = c.declare(Token{TokenType: SUPER, Lexeme: "super", Line: stmt.Name.Line, Column: stmt.Name.Column}, stmt.Superclass.ID)
+	}
+
+	names := make([]string, len(stmt.Methods))
+	methods := make([]exprFn, len(stmt.Methods))
+	for i, method := range stmt.Methods {
+		names[i] = method.Name.Lexeme
+		kind := functionMethod
+		if method.Name.Lexeme == "init" {
+			kind = functionInitializer
+		}
+		methods[i] = c.function(method, kind)
+	}
+
+	if stmt.Superclass != nil {
+		c.endScope()
+	}
+
+	superToken := Token{}
+	if stmt.Superclass != nil {
+		superToken = stmt.Superclass.Name
+	}
+
+	return c.define(variable, func(fr *frame) Value {
+		class := &closureClass{
+			Name:    name,
+			Methods: make(map[string]*closureFunction),
+		}
+
+		if superclass != nil {
+			super, isClass := superclass(fr).AsObject().(*closureClass)
+			if !isClass {
+				panic(RuntimeError{superToken, "superclass must be a class"})
+			}
+			class.Superclass = super
+
+			if superVar.kind == varBoxed {
+				fr.cells[superVar.index] = &cell{ObjectValue(super)}
+			} else {
+				fr.slots[superVar.index] = ObjectValue(super)
+			}
+		}
+
+		for i, method := range methods {
+			class.Methods[names[i]] = method(fr).AsObject().(*closureFunction)
+		}
+		return ObjectValue(class)
+	})
+}
+
+func (c *closureCompiler) VisitExpressionStmt(stmt Expression) interface{} {
+	expr := c.compileExpr(stmt.Expression)
+	return stmtFn(func(fr *frame) bool {
+		expr(fr)
+		return false
+	})
+}
+
+func (c *closureCompiler) VisitFunctionStmt(stmt Function) interface{} {
+	variable := c.declare(stmt.Name, stmt.ID)
+	return c.define(variable, c.function(stmt, functionFunction))
+}
+
+func (c *closureCompiler) VisitIfStmt(stmt If) interface{} {
+	condition := c.compileExpr(stmt.Condition)
+	thenBranch := c.compileStmt(stmt.ThenBranch)
+	if stmt.ElseBranch == nil {
+		return stmtFn(func(fr *frame) bool {
+			if condition(fr).IsTruthy() {
+				return thenBranch(fr)
+			}
+			return false
+		})
+	}
+
+	elseBranch := c.compileStmt(stmt.ElseBranch)
+	return stmtFn(func(fr *frame) bool {
+		if condition(fr).IsTruthy() {
+			return thenBranch(fr)
+		}
+		return elseBranch(fr)
+	})
+}
+
+func (c *closureCompiler) VisitPrintStmt(stmt Print) interface{} {
+	expr := c.compileExpr(stmt.Expression)
+	stdout := c.streams.stdout()
+	return stmtFn(func(fr *frame) bool {
+		fmt.Fprintln(stdout, expr(fr))
+		return false
+	})
+}
+
+func (c *closureCompiler) VisitReturnStmt(stmt Return) interface{} {
+	if stmt.Value == nil {
+		return stmtFn(func(fr *frame) bool {
+			return true
+		})
+	}
+
+	value := c.compileExpr(stmt.Value)
+	return stmtFn(func(fr *frame) bool {
+		fr.ret = value(fr)
+		return true
+	})
+}
+
+func (c *closureCompiler) VisitVarStmt(stmt Var) interface{} {
+	variable := c.declare(stmt.Name, stmt.ID)
+
+	initializer := exprFn(func(fr *frame) Value {
+		return NilValue
+	})
+	if stmt.Initializer != nil {
+		initializer = c.compileExpr(stmt.Initializer)
+	}
+
+	return c.define(variable, initializer)
+}
+
+func (c *closureCompiler) VisitWhileStmt(stmt While) interface{} {
+	condition := c.compileExpr(stmt.Condition)
+	body := c.compileStmt(stmt.Body)
+	b := c.budget
+	return stmtFn(func(fr *frame) bool {
+		for condition(fr).IsTruthy() {
+			b.step()
+			if body(fr) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (c *closureCompiler) VisitAssignExpr(expr Assign) interface{} {
+	value := c.compileExpr(expr.Value)
+	name := expr.Name
+
+	variable := c.resolve(name)
+	index := variable.index
+	switch variable.kind {
+	case varLocal:
+		return exprFn(func(fr *frame) Value {
+			v := value(fr)
+			fr.slots[index] = v
+			return v
+		})
+	case varBoxed:
+		return exprFn(func(fr *frame) Value {
+			v := value(fr)
+			fr.cells[index].value = v
+			return v
+		})
+	case varUpvalue:
+		return exprFn(func(fr *frame) Value {
+			v := value(fr)
+			fr.upvalues[index].value = v
+			return v
+		})
+	}
+
+	g := variable.global
+	return exprFn(func(fr *frame) Value {
+		v := value(fr)
+		if !g.defined {
+			panic(RuntimeError{name, fmt.Sprintf("undefined variable '%s'", name.Lexeme)})
+		}
+		g.value = v
+		return v
+	})
+}
+
+func (c *closureCompiler) VisitBinaryExpr(expr Binary) interface{} {
+	left := c.compileExpr(expr.Left)
+	right := c.compileExpr(expr.Right)
+	operator := expr.Operator
+
+	var fn exprFn
+	switch operator.TokenType {
+	case GREATER:
+		fn = func(fr *frame) Value {
+			l, r := checkNumberOperands(operator, left(fr), right(fr))
+			return BoolValue(l > r)
+		}
+	case GREATER_EQUAL:
+		fn = func(fr *frame) Value {
+			l, r := checkNumberOperands(operator, left(fr), right(fr))
+			return BoolValue(l >= r)
+		}
+	case LESS:
+		fn = func(fr *frame) Value {
+			l, r := checkNumberOperands(operator, left(fr), right(fr))
+			return BoolValue(l < r)
+		}
+	case LESS_EQUAL:
+		fn = func(fr *frame) Value {
+			l, r := checkNumberOperands(operator, left(fr), right(fr))
+			return BoolValue(l <= r)
+		}
+	case BANG_EQUAL:
+		fn = func(fr *frame) Value {
+			return BoolValue(!left(fr).Equal(right(fr)))
+		}
+	case EQUAL_EQUAL:
+		fn = func(fr *frame) Value {
+			return BoolValue(left(fr).Equal(right(fr)))
+		}
+	case MINUS:
+		fn = func(fr *frame) Value {
+			l, r := checkNumberOperands(operator, left(fr), right(fr))
+			return NumberValue(l - r)
+		}
+	case STAR:
+		fn = func(fr *frame) Value {
+			l, r := checkNumberOperands(operator, left(fr), right(fr))
+			return NumberValue(l * r)
+		}
+	case STARSTAR:
+		fn = func(fr *frame) Value {
+			l, r := checkNumberOperands(operator, left(fr), right(fr))
+			return NumberValue(math.Pow(l, r))
+		}
+	case SLASH:
+		fn = func(fr *frame) Value {
+			l, r := checkNumberOperands(operator, left(fr), right(fr))
+			return NumberValue(l / r)
+		}
+	case PLUS:
+		b := c.budget
+		fn = func(fr *frame) Value {
+			l, r := left(fr), right(fr)
+			if l.IsNumber() && r.IsNumber() {
+				return NumberValue(l.AsNumber() + r.AsNumber())
+			}
+
+			if l.IsString() && r.IsString() {
+				s := l.AsString() + r.AsString()
+				b.allocate(operator, stringSize+len(s))
+				return StringValue(s)
+			}
+
+			panic(RuntimeError{operator, "operands must be two numbers or two strings"})
+		}
+	default:
+		fn = func(fr *frame) Value {
+			left(fr)
+			right(fr)
+			return NilValue
+		}
+	}
+	return fn
+}
+
+func (c *closureCompiler) VisitCallExpr(expr Call) interface{} {
+	callee := c.compileExpr(expr.Callee)
+	args := make([]exprFn, len(expr.Arguments))
+	for i, arg := range expr.Arguments {
+		args[i] = c.compileExpr(arg)
+	}
+	paren := expr.Paren
+	streams := c.streams
+	b := c.budget
+
+	// The arguments are evaluated before the call is counted against the
+	// budget, so calls in them are made at the caller's depth
+	return exprFn(func(fr *frame) Value {
+		value := callee(fr)
+
+		// Calls to functions with the right number of arguments are by far
+		// the most common, so their arguments go straight into their slots
+		if function, isFunction := value.AsObject().(*closureFunction); isFunction && function.proto.arity == len(args) {
+			slots := make([]Value, function.proto.slotCount)
+			for i, arg := range args {
+				slots[i] = arg(fr)
+			}
+
+			b.step()
+			b.enter(paren)
+			defer b.leave()
+			return function.run(NilValue, slots)
+		}
+
+		values := make([]Value, len(args))
+		for i, arg := range args {
+			values[i] = arg(fr)
+		}
+
+		b.step()
+		if _, isClass := value.AsObject().(*closureClass); isClass {
+			b.allocate(paren, instanceSize)
+		}
+		b.enter(paren)
+		defer b.leave()
+		return callValue(streams, paren, value, values)
+	})
+}
+
+func (c *closureCompiler) VisitGetExpr(expr Get) interface{} {
+	object := c.compileExpr(expr.Object)
+	name := expr.Name
+
+	return exprFn(func(fr *frame) Value {
+		obj := object(fr).AsObject()
+		if properties, hasProperties := obj.(PropertyObject); hasProperties {
+			value, err := properties.GetProperty(name.Lexeme)
+			if err != nil {
+				panic(RuntimeError{name, err.Error()})
+			}
+			return value
+		}
+
+		instance, isInstance := obj.(*closureInstance)
+		if !isInstance {
+			panic(RuntimeError{name, "only instances have properties"})
+		}
+		return instance.get(name)
+	})
+}
+
+func (c *closureCompiler) VisitGroupingExpr(expr Grouping) interface{} {
+	return c.compileExpr(expr.Expression)
+}
+
+func (c *closureCompiler) VisitLiteralExpr(expr Literal) interface{} {
+	value := expr.Value
+	return exprFn(func(fr *frame) Value {
+		return value
+	})
+}
+
+func (c *closureCompiler) VisitLogicalExpr(expr Logical) interface{} {
+	left := c.compileExpr(expr.Left)
+	right := c.compileExpr(expr.Right)
+
+	if expr.Operator.TokenType == OR {
+		return exprFn(func(fr *frame) Value {
+			if value := left(fr); value.IsTruthy() {
+				return value
+			}
+			return right(fr)
+		})
+	}
+
+	return exprFn(func(fr *frame) Value {
+		if value := left(fr); !value.IsTruthy() {
+			return value
+		}
+		return right(fr)
+	})
+}
+
+func (c *closureCompiler) VisitSetExpr(expr Set) interface{} {
+	object := c.compileExpr(expr.Object)
+	value := c.compileExpr(expr.Value)
+	name := expr.Name
+	b := c.budget
+
+	return exprFn(func(fr *frame) Value {
+		obj := object(fr).AsObject()
+		if properties, hasProperties := obj.(PropertyObject); hasProperties {
+			v := value(fr)
+			if err := properties.SetProperty(name.Lexeme, v); err != nil {
+				panic(RuntimeError{name, err.Error()})
+			}
+			return v
+		}
+
+		instance, isInstance := obj.(*closureInstance)
+		if !isInstance {
+			panic(RuntimeError{name, "only instances have fields"})
+		}
+
+		v := value(fr)
+		if _, hasField := instance.Fields[name.Lexeme]; !hasField {
+			b.allocate(name, fieldSize)
+		}
+		instance.Fields[name.Lexeme] = v
+		return v
+	})
+}
+
+func (c *closureCompiler) VisitSuperExpr(expr Super) interface{} {
+	superclass := c.variable(expr.Keyword)
+	this := c.variable(Token{TokenType: THIS, Lexeme: "this"})
+	method := expr.Method
+
+	return exprFn(func(fr *frame) Value {
+		found := superclass(fr).AsObject().(*closureClass).findMethod(method.Lexeme)
+		if found == nil {
+			panic(RuntimeError{method, fmt.Sprintf("undefined property '%s'", method.Lexeme)})
+		}
+
+		return ObjectValue(&closureBoundMethod{
+			Receiver: this(fr).AsObject().(*closureInstance),
+			Method:   found,
+		})
+	})
+}
+
+func (c *closureCompiler) VisitThisExpr(expr This) interface{} {
+	return c.variable(expr.Keyword)
+}
+
+func (c *closureCompiler) VisitUnaryExpr(expr Unary) interface{} {
+	right := c.compileExpr(expr.Right)
+	operator := expr.Operator
+
+	if operator.TokenType == BANG {
+		return exprFn(func(fr *frame) Value {
+			return BoolValue(!right(fr).IsTruthy())
+		})
+	}
+
+	return exprFn(func(fr *frame) Value {
+		return NumberValue(-checkNumberOperand(operator, right(fr)))
+	})
+}
+
+func (c *closureCompiler) VisitVariableExpr(expr Variable) interface{} {
+	return c.variable(expr.Name)
+}
+
+func (c *closureCompiler) compileStmts(stmts []Stmt) stmtFn {
+	fns := make([]stmtFn, len(stmts))
+	for i, stmt := range stmts {
+		fns[i] = c.compileStmt(stmt)
+	}
+
+	if len(fns) == 1 {
+		return fns[0]
+	}
+	return func(fr *frame) bool {
+		for _, fn := range fns {
+			if fn(fr) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c *closureCompiler) compileStmt(stmt Stmt) stmtFn {
+	var v StmtVisitor = c
+	return stmt.Accept(&v).(stmtFn)
+}
+
+func (c *closureCompiler) compileExpr(expr Expr) exprFn {
+	var v ExprVisitor = c
+	return expr.Accept(&v).(exprFn)
+}
+
+// function compiles a function body and returns the code that creates a closure over it
+func (c *closureCompiler) function(stmt Function, kind int) exprFn {
+	c.current = &closureState{enclosing: c.current}
+	c.beginScope()
+
+	proto := &closureProto{
+		name:          stmt.Name.Lexeme,
+		arity:         len(stmt.Params),
+		isMethod:      kind == functionMethod || kind == functionInitializer,
+		isInitializer: kind == functionInitializer,
+	}
+
+	// Methods keep this in slot 0, before their parameters. A method's name
+	// isn't a variable so this takes its ID, the parameters have the IDs
+	// after it
+	if proto.isMethod {
+		this := c.declare(Token{TokenType: THIS, Lexeme: "this", Line: stmt.Name.Line, Column: stmt.Name.Column}, stmt.ID)
+		if this.kind == varBoxed {
+			proto.boxed = append(proto.boxed, this.index)
+		}
+	}
+	for i, param := range stmt.Params {
+		if variable := c.declare(param, stmt.ID+1+i); variable.kind == varBoxed {
+			proto.boxed = append(proto.boxed, variable.index)
+		}
+	}
+
+	proto.body = c.compileStmts(stmt.Body)
+	proto.slotCount = c.current.slotCount
+	proto.hasCells = c.current.hasCells
+	proto.upvalues = c.current.upvalues
+	c.current = c.current.enclosing
+
+	return func(fr *frame) Value {
+		function := &closureFunction{
+			proto:    proto,
+			upvalues: make([]*cell, len(proto.upvalues)),
+		}
+		for i, upvalue := range proto.upvalues {
+			if upvalue.isLocal {
+				function.upvalues[i] = fr.cells[upvalue.index]
+			} else {
+				function.upvalues[i] = fr.upvalues[upvalue.index]
+			}
+		}
+		return ObjectValue(function)
+	}
+}
+
+func (c *closureCompiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+// endScope forgets the scope's locals so their slots can be reused
+func (c *closureCompiler) endScope() {
+	state := c.current
+	state.scopeDepth--
+
+	for len(state.locals) > 0 && state.locals[len(state.locals)-1].depth > state.scopeDepth {
+		state.locals = state.locals[:len(state.locals)-1]
+	}
+}
+
+// declare adds a variable to the current scope, or makes it global at the top level of the script
+func (c *closureCompiler) declare(name Token, id int) varRef {
+	state := c.current
+	if state.scopeDepth == 0 {
+		return varRef{kind: varGlobal, global: c.global(name.Lexeme)}
+	}
+
+	state.locals = append(state.locals, closureLocal{
+		name:  name.Lexeme,
+		decl:  id,
+		depth: state.scopeDepth,
+	})
+	if len(state.locals) > state.slotCount {
+		state.slotCount = len(state.locals)
+	}
+
+	slot := len(state.locals) - 1
+	if c.captured[id] {
+		state.hasCells = true
+		return varRef{kind: varBoxed, index: slot}
+	}
+	return varRef{kind: varLocal, index: slot}
+}
+
+// define returns a statement that creates variable and then sets it to the
+// value of initializer. Boxed variables get their cell first so that a
+// function or class can capture itself
+func (c *closureCompiler) define(variable varRef, initializer exprFn) stmtFn {
+	index := variable.index
+	switch variable.kind {
+	case varLocal:
+		return func(fr *frame) bool {
+			fr.slots[index] = initializer(fr)
+			return false
+		}
+	case varBoxed:
+		return func(fr *frame) bool {
+			box := &cell{}
+			fr.cells[index] = box
+			box.value = initializer(fr)
+			return false
+		}
+	}
+
+	g := variable.global
+	return func(fr *frame) bool {
+		g.value = initializer(fr)
+		g.defined = true
+		return false
+	}
+}
+
+// variable returns the code that reads name
+func (c *closureCompiler) variable(name Token) exprFn {
+	variable := c.resolve(name)
+	index := variable.index
+	switch variable.kind {
+	case varLocal:
+		return func(fr *frame) Value {
+			return fr.slots[index]
+		}
+	case varBoxed:
+		return func(fr *frame) Value {
+			return fr.cells[index].value
+		}
+	case varUpvalue:
+		return func(fr *frame) Value {
+			return fr.upvalues[index].value
+		}
+	}
+
+	g := variable.global
+	return func(fr *frame) Value {
+		if !g.defined {
+			panic(RuntimeError{name, fmt.Sprintf("undefined variable '%s'", name.Lexeme)})
+		}
+		return g.value
+	}
+}
+
+// resolve finds where the variable called name lives, looking through the
+// current function, then the functions around it and then the globals
+func (c *closureCompiler) resolve(name Token) varRef {
+	if slot := c.resolveLocal(c.current, name.Lexeme); slot != -1 {
+		if c.captured[c.current.locals[slot].decl] {
+			return varRef{kind: varBoxed, index: slot}
+		}
+		return varRef{kind: varLocal, index: slot}
+	}
+
+	if upvalue := c.resolveUpvalue(c.current, name.Lexeme); upvalue != -1 {
+		return varRef{kind: varUpvalue, index: upvalue}
+	}
+
+	return varRef{kind: varGlobal, global: c.global(name.Lexeme)}
+}
+
+func (c *closureCompiler) resolveLocal(state *closureState, name string) int {
+	for i := len(state.locals) - 1; i >= 0; i-- {
+		if state.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveUpvalue looks for name in the enclosing functions, marking it as
+// captured and adding an upvalue to each function in between
+func (c *closureCompiler) resolveUpvalue(state *closureState, name string) int {
+	if state.enclosing == nil {
+		return -1
+	}
+
+	if local := c.resolveLocal(state.enclosing, name); local != -1 {
+		c.captured[state.enclosing.locals[local].decl] = true
+		return addClosureUpvalue(state, local, true)
+	}
+
+	if upvalue := c.resolveUpvalue(state.enclosing, name); upvalue != -1 {
+		return addClosureUpvalue(state, upvalue, false)
+	}
+
+	return -1
+}
+
+func addClosureUpvalue(state *closureState, index int, isLocal bool) int {
+	for i, upvalue := range state.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return i
+		}
+	}
+
+	state.upvalues = append(state.upvalues, upvalueRef{index, isLocal})
+	return len(state.upvalues) - 1
+}
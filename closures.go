@@ -0,0 +1,302 @@
+package glox
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// exprFn is an expression compiled to a Go closure
+type exprFn func(fr *frame) Value
+
+// stmtFn is a statement compiled to a Go closure, it returns true if a
+// return statement was executed, with the value left in the frame
+type stmtFn func(fr *frame) bool
+
+// frame is a call of a closure compiled function. Locals live in slots,
+// except those captured by a nested function, which are kept in a cell at
+// the same index of cells so the closure and the frame share them
+type frame struct {
+	slots    []Value
+	cells    []*cell
+	upvalues []*cell
+	ret      Value
+}
+
+// cell holds a variable captured by a closure
+type cell struct {
+	value Value
+}
+
+// global is a global variable, the compiler looks it up once so running code never has to
+type global struct {
+	value   Value
+	defined bool
+}
+
+// closureProto is what the compiler knows about a function, everything but
+// the variables a particular closure over it has captured
+type closureProto struct {
+	name          string
+	arity         int
+	slotCount     int
+	boxed         []int // Slots of parameters (and this) captured by a nested function
+	hasCells      bool  // Whether any local is captured, so the frame needs cells
+	isMethod      bool
+	isInitializer bool
+	upvalues      []upvalueRef
+	body          stmtFn
+}
+
+type closureFunction struct {
+	proto    *closureProto
+	upvalues []*cell
+}
+
+// Arity returns the number of parameters the function expects
+func (fn *closureFunction) Arity() int {
+	return fn.proto.arity
+}
+
+// Call runs the function with args
+func (fn *closureFunction) Call(intr *Interpreter, args []Value) Value {
+	return fn.call(NilValue, args)
+}
+
+// call copies args into a new set of slots, after the receiver for methods, and runs the function
+func (fn *closureFunction) call(receiver Value, args []Value) Value {
+	slots := make([]Value, fn.proto.slotCount)
+	if fn.proto.isMethod {
+		copy(slots[1:], args)
+	} else {
+		copy(slots, args)
+	}
+	return fn.run(receiver, slots)
+}
+
+// run runs the function in slots, which already hold its arguments
+func (fn *closureFunction) run(receiver Value, slots []Value) Value {
+	proto := fn.proto
+	if proto.isMethod {
+		slots[0] = receiver
+	}
+	fr := &frame{
+		slots:    slots,
+		upvalues: fn.upvalues,
+	}
+	if proto.hasCells {
+		fr.cells = make([]*cell, len(slots))
+	}
+	for _, slot := range proto.boxed {
+		fr.cells[slot] = &cell{slots[slot]}
+	}
+	proto.body(fr)
+
+	if proto.isInitializer {
+		return receiver
+	}
+	return fr.ret
+}
+
+func (fn *closureFunction) String() string {
+	return fmt.Sprintf("<fn %s>", fn.proto.name)
+}
+
+type closureClass struct {
+	Name       string
+	Superclass *closureClass
+	Methods    map[string]*closureFunction
+}
+
+// findMethod looks up a method on the class, falling back to its superclasses
+func (class *closureClass) findMethod(name string) *closureFunction {
+	if method, hasMethod := class.Methods[name]; hasMethod {
+		return method
+	}
+
+	if class.Superclass != nil {
+		return class.Superclass.findMethod(name)
+	}
+
+	return nil
+}
+
+// Arity returns the arity of the class initializer, or 0 if there is none
+func (class *closureClass) Arity() int {
+	if initializer := class.findMethod("init"); initializer != nil {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+// Call creates a new instance of the class and runs its initializer
+func (class *closureClass) Call(intr *Interpreter, args []Value) Value {
+	instance := &closureInstance{
+		Class:  class,
+		Fields: make(map[string]Value),
+	}
+
+	if initializer := class.findMethod("init"); initializer != nil {
+		initializer.call(ObjectValue(instance), args)
+	}
+
+	return ObjectValue(instance)
+}
+
+func (class *closureClass) String() string {
+	return class.Name
+}
+
+type closureInstance struct {
+	Class  *closureClass
+	Fields map[string]Value
+}
+
+func (instance *closureInstance) get(name Token) Value {
+	if value, hasField := instance.Fields[name.Lexeme]; hasField {
+		return value
+	}
+
+	if method := instance.Class.findMethod(name.Lexeme); method != nil {
+		return ObjectValue(&closureBoundMethod{
+			Receiver: instance,
+			Method:   method,
+		})
+	}
+
+	panic(RuntimeError{name, fmt.Sprintf("undefined property '%s'", name.Lexeme)})
+}
+
+func (instance *closureInstance) String() string {
+	return instance.Class.Name + " instance"
+}
+
+type closureBoundMethod struct {
+	Receiver *closureInstance
+	Method   *closureFunction
+}
+
+// Arity returns the number of parameters the method expects
+func (bound *closureBoundMethod) Arity() int {
+	return bound.Method.Arity()
+}
+
+// Call runs the method with this set to the receiver
+func (bound *closureBoundMethod) Call(intr *Interpreter, args []Value) Value {
+	return bound.Method.call(ObjectValue(bound.Receiver), args)
+}
+
+func (bound *closureBoundMethod) String() string {
+	return bound.Method.String()
+}
+
+// callValue calls callee with args, checking it can be called with that
+// many arguments. Natives are given streams for their Interpreter
+func callValue(streams *Interpreter, paren Token, callee Value, args []Value) Value {
+	function, isCallable := callee.AsObject().(LoxCallable)
+	if !isCallable {
+		panic(RuntimeError{paren, "can only call functions and classes"})
+	}
+
+	if len(args) != function.Arity() {
+		panic(RuntimeError{paren, fmt.Sprintf("expected %v arguments but got %v", function.Arity(), len(args))})
+	}
+
+	if native, isNative := function.(*NativeFunction); isNative {
+		value, err := native.Function(streams, args)
+		if err != nil {
+			panic(nativeError(paren, err))
+		}
+		return value
+	}
+
+	return function.Call(streams, args)
+}
+
+// ClosureInterpreter runs programs by first turning each node of the syntax
+// tree into a Go closure, with every variable resolved to a slot, and then
+// calling the closure made for the program. It skips the visitor dispatch
+// and environment lookups the tree walking Interpreter does at every node.
+// Programs must already have been checked by the Resolver
+type ClosureInterpreter struct {
+	// Globals holds the global variables. It is read at the start of each
+	// call to Interpret and updated with their values at the end
+	Globals map[string]Value
+
+	// Stdout, Stderr and Stdin are the streams print and the natives use,
+	// and Reporter is sent the errors passed to Report, as described on
+	// Interpreter
+	Stdout   io.Writer
+	Stderr   io.Writer
+	Stdin    io.Reader
+	Reporter Reporter
+
+	// Context, StepBudget, MaxCallDepth and MaxAllocation limit each call
+	// to Interpret as described on Interpreter
+	Context       context.Context
+	StepBudget    int
+	MaxCallDepth  int
+	MaxAllocation int
+
+	globals map[string]*global
+}
+
+// Interpret compiles and runs stmts, stopping at and returning the first runtime error
+func (ci *ClosureInterpreter) Interpret(stmts []Stmt) (err error) {
+	if ci.Globals == nil {
+		ci.Globals = make(map[string]Value)
+	}
+	if ci.globals == nil {
+		ci.globals = make(map[string]*global)
+	}
+	for name, value := range ci.Globals {
+		ci.global(name).value = value
+		ci.global(name).defined = true
+	}
+
+	script := compileClosures(stmts, ci.global, ci.newStreams(), newBudget(ci.Context, ci.StepBudget, ci.MaxCallDepth, ci.MaxAllocation))
+
+	defer func() {
+		for name, variable := range ci.globals {
+			if variable.defined {
+				ci.Globals[name] = variable.value
+			}
+		}
+	}()
+	defer recoverError(&err)
+
+	fr := &frame{
+		slots: make([]Value, script.slotCount),
+	}
+	if script.hasCells {
+		fr.cells = make([]*cell, script.slotCount)
+	}
+	script.body(fr)
+	return nil
+}
+
+// Report sends err to the Reporter, or writes it to Stderr if there isn't one
+func (ci *ClosureInterpreter) Report(err error) {
+	ci.newStreams().Report(err)
+}
+
+// newStreams returns an Interpreter with only the streams and Reporter set,
+// which is what natives and Report need of one
+func (ci *ClosureInterpreter) newStreams() *Interpreter {
+	return &Interpreter{
+		Stdout:   ci.Stdout,
+		Stderr:   ci.Stderr,
+		Stdin:    ci.Stdin,
+		Reporter: ci.Reporter,
+	}
+}
+
+// global returns the global variable called name, creating it undefined if it doesn't exist yet
+func (ci *ClosureInterpreter) global(name string) *global {
+	variable, exists := ci.globals[name]
+	if !exists {
+		variable = &global{}
+		ci.globals[name] = variable
+	}
+	return variable
+}
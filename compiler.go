@@ -0,0 +1,621 @@
+package glox
+
+const (
+	maxLocals    = 256
+	maxUpvalues  = 256
+	maxConstants = 1 << 16
+	maxJump      = 1<<16 - 1
+)
+
+// local is a variable that lives in a stack slot of the function being compiled
+type local struct {
+	name       string
+	depth      int // -1 until the variable's initializer has been compiled
+	isCaptured bool
+}
+
+// upvalueRef says where a closure finds a captured variable when it is
+// created, either in a local slot or an upvalue of the enclosing function
+type upvalueRef struct {
+	index   int
+	isLocal bool
+}
+
+// functionState is the compiler's view of the function currently being compiled
+type functionState struct {
+	enclosing  *functionState
+	function   *CompiledFunction
+	kind       int
+	locals     []local
+	upvalues   []upvalueRef
+	scopeDepth int
+}
+
+// compiler turns a syntax tree into bytecode for the VM
+type compiler struct {
+	current *functionState
+	token   Token // The most recent token seen, used for line numbers and errors
+	errors  []ParseError
+}
+
+// Compile compiles a program into a function that the VM can run. The
+// Resolver is run first so the same static errors are reported as for the
+// tree walking Interpreter
+func Compile(stmts []Stmt) (*CompiledFunction, error) {
+	resolver := Resolver{}
+	if err := resolver.Resolve(stmts); err != nil {
+		return nil, err
+	}
+
+	c := &compiler{}
+	c.beginFunction(functionNone, "")
+	for _, stmt := range stmts {
+		c.compileStmt(stmt)
+	}
+	function, _ := c.endFunction()
+
+	if len(c.errors) > 0 {
+		return nil, ParseErrors(c.errors)
+	}
+	return function, nil
+}
+
+func (c *compiler) VisitBlockStmt(stmt Block) interface{} {
+	c.beginScope()
+	for _, s := range stmt.Statements {
+		c.compileStmt(s)
+	}
+	c.endScope()
+	return nil
+}
+
+func (c *compiler) VisitClassStmt(stmt Class) interface{} {
+	c.token = stmt.Name
+	name := c.identifierConstant(stmt.Name.Lexeme)
+	c.declareVariable(stmt.Name)
+
+	c.emitShort(OP_CLASS, name)
+	c.defineVariable(name)
+
+	if stmt.Superclass != nil {
+		c.namedVariable(stmt.Superclass.Name, false)
+
+		c.beginScope()
+		c.addLocal("super")
+		c.markInitialized()
+
+		c.namedVariable(stmt.Name, false)
+		c.emit(OP_INHERIT)
+	}
+
+	c.namedVariable(stmt.Name, false)
+	for _, method := range stmt.Methods {
+		c.token = method.Name
+		constant := c.identifierConstant(method.Name.Lexeme)
+
+		kind := functionMethod
+		if method.Name.Lexeme == "init" {
+			kind = functionInitializer
+		}
+		c.function(method, kind)
+		c.emitShort(OP_METHOD, constant)
+	}
+	c.emit(OP_POP)
+
+	if stmt.Superclass != nil {
+		c.endScope()
+	}
+	return nil
+}
+
+func (c *compiler) VisitExpressionStmt(stmt Expression) interface{} {
+	// Every expression sets the token, so the pop gets the line the
+	// expression ends on
+	c.compileExpr(stmt.Expression)
+	c.emit(OP_POP)
+	return nil
+}
+
+func (c *compiler) VisitFunctionStmt(stmt Function) interface{} {
+	c.token = stmt.Name
+	global := c.parseVariable(stmt.Name)
+	c.markInitialized()
+	c.function(stmt, functionFunction)
+	c.defineVariable(global)
+	return nil
+}
+
+func (c *compiler) VisitIfStmt(stmt If) interface{} {
+	c.compileExpr(stmt.Condition)
+
+	c.token = stmt.Keyword
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emit(OP_POP)
+	c.compileStmt(stmt.ThenBranch)
+
+	c.token = stmt.Keyword
+	elseJump := c.emitJump(OP_JUMP)
+	c.patchJump(thenJump)
+	c.emit(OP_POP)
+
+	if stmt.ElseBranch != nil {
+		c.compileStmt(stmt.ElseBranch)
+	}
+	c.patchJump(elseJump)
+	return nil
+}
+
+func (c *compiler) VisitPrintStmt(stmt Print) interface{} {
+	c.compileExpr(stmt.Expression)
+	c.token = stmt.Keyword
+	c.emit(OP_PRINT)
+	return nil
+}
+
+func (c *compiler) VisitReturnStmt(stmt Return) interface{} {
+	c.token = stmt.Keyword
+	if stmt.Value == nil {
+		c.emitReturn()
+		return nil
+	}
+
+	c.compileExpr(stmt.Value)
+	c.emit(OP_RETURN)
+	return nil
+}
+
+func (c *compiler) VisitVarStmt(stmt Var) interface{} {
+	c.token = stmt.Name
+	global := c.parseVariable(stmt.Name)
+
+	if stmt.Initializer != nil {
+		c.compileExpr(stmt.Initializer)
+	} else {
+		c.emit(OP_NIL)
+	}
+
+	c.defineVariable(global)
+	return nil
+}
+
+func (c *compiler) VisitWhileStmt(stmt While) interface{} {
+	loopStart := len(c.chunk().Code)
+	c.compileExpr(stmt.Condition)
+
+	c.token = stmt.Keyword
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emit(OP_POP)
+	c.compileStmt(stmt.Body)
+	c.token = stmt.Keyword
+	c.emitLoop(loopStart)
+
+	c.patchJump(exitJump)
+	c.emit(OP_POP)
+	return nil
+}
+
+func (c *compiler) VisitAssignExpr(expr Assign) interface{} {
+	c.compileExpr(expr.Value)
+	c.token = expr.Name
+	c.namedVariable(expr.Name, true)
+	return nil
+}
+
+func (c *compiler) VisitBinaryExpr(expr Binary) interface{} {
+	c.compileExpr(expr.Left)
+	c.compileExpr(expr.Right)
+
+	c.token = expr.Operator
+	switch expr.Operator.TokenType {
+	case BANG_EQUAL:
+		c.emit(OP_EQUAL, OP_NOT)
+	case EQUAL_EQUAL:
+		c.emit(OP_EQUAL)
+	case GREATER:
+		c.emit(OP_GREATER)
+	case GREATER_EQUAL:
+		c.emit(OP_GREATER_EQUAL)
+	case LESS:
+		c.emit(OP_LESS)
+	case LESS_EQUAL:
+		c.emit(OP_LESS_EQUAL)
+	case PLUS:
+		c.emit(OP_ADD)
+	case MINUS:
+		c.emit(OP_SUBTRACT)
+	case STAR:
+		c.emit(OP_MULTIPLY)
+	case SLASH:
+		c.emit(OP_DIVIDE)
+	case STARSTAR:
+		c.emit(OP_POWER)
+	}
+	return nil
+}
+
+func (c *compiler) VisitCallExpr(expr Call) interface{} {
+	switch callee := expr.Callee.(type) {
+	case Get:
+		// Calling a method straight away skips creating a bound method
+		c.compileExpr(callee.Object)
+		c.compileArgs(expr.Arguments)
+		c.token = callee.Name
+		c.emitShort(OP_INVOKE, c.identifierConstant(callee.Name.Lexeme))
+		c.emit(byte(len(expr.Arguments)))
+	case Super:
+		c.token = callee.Keyword
+		c.namedVariable(Token{TokenType: THIS, Lexeme: "this", Line: callee.Keyword.Line}, false)
+		c.compileArgs(expr.Arguments)
+		c.token = callee.Method
+		c.namedVariable(callee.Keyword, false)
+		c.emitShort(OP_SUPER_INVOKE, c.identifierConstant(callee.Method.Lexeme))
+		c.emit(byte(len(expr.Arguments)))
+	default:
+		c.compileExpr(expr.Callee)
+		c.compileArgs(expr.Arguments)
+		c.token = expr.Paren
+		c.emit(OP_CALL, byte(len(expr.Arguments)))
+	}
+	return nil
+}
+
+func (c *compiler) VisitGetExpr(expr Get) interface{} {
+	c.compileExpr(expr.Object)
+	c.token = expr.Name
+	c.emitShort(OP_GET_PROPERTY, c.identifierConstant(expr.Name.Lexeme))
+	return nil
+}
+
+func (c *compiler) VisitGroupingExpr(expr Grouping) interface{} {
+	c.compileExpr(expr.Expression)
+	return nil
+}
+
+func (c *compiler) VisitLiteralExpr(expr Literal) interface{} {
+	c.token = expr.Token
+	switch {
+	case expr.Value.IsNil():
+		c.emit(OP_NIL)
+	case expr.Value.Type() == VAL_BOOL && expr.Value.AsBool():
+		c.emit(OP_TRUE)
+	case expr.Value.Type() == VAL_BOOL:
+		c.emit(OP_FALSE)
+	default:
+		c.emitShort(OP_CONSTANT, c.makeConstant(expr.Value))
+	}
+	return nil
+}
+
+func (c *compiler) VisitLogicalExpr(expr Logical) interface{} {
+	c.compileExpr(expr.Left)
+	c.token = expr.Operator
+
+	if expr.Operator.TokenType == AND {
+		endJump := c.emitJump(OP_JUMP_IF_FALSE)
+		c.emit(OP_POP)
+		c.compileExpr(expr.Right)
+		c.patchJump(endJump)
+		return nil
+	}
+
+	elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+	endJump := c.emitJump(OP_JUMP)
+	c.patchJump(elseJump)
+	c.emit(OP_POP)
+	c.compileExpr(expr.Right)
+	c.patchJump(endJump)
+	return nil
+}
+
+func (c *compiler) VisitSetExpr(expr Set) interface{} {
+	c.compileExpr(expr.Object)
+	c.compileExpr(expr.Value)
+	c.token = expr.Name
+	c.emitShort(OP_SET_PROPERTY, c.identifierConstant(expr.Name.Lexeme))
+	return nil
+}
+
+func (c *compiler) VisitSuperExpr(expr Super) interface{} {
+	c.token = expr.Keyword
+	c.namedVariable(Token{TokenType: THIS, Lexeme: "this", Line: expr.Keyword.Line}, false)
+	c.namedVariable(expr.Keyword, false)
+	c.token = expr.Method
+	c.emitShort(OP_GET_SUPER, c.identifierConstant(expr.Method.Lexeme))
+	return nil
+}
+
+func (c *compiler) VisitThisExpr(expr This) interface{} {
+	c.token = expr.Keyword
+	c.namedVariable(expr.Keyword, false)
+	return nil
+}
+
+func (c *compiler) VisitUnaryExpr(expr Unary) interface{} {
+	c.compileExpr(expr.Right)
+	c.token = expr.Operator
+
+	switch expr.Operator.TokenType {
+	case BANG:
+		c.emit(OP_NOT)
+	case MINUS:
+		c.emit(OP_NEGATE)
+	}
+	return nil
+}
+
+func (c *compiler) VisitVariableExpr(expr Variable) interface{} {
+	c.token = expr.Name
+	c.namedVariable(expr.Name, false)
+	return nil
+}
+
+func (c *compiler) compileStmt(stmt Stmt) {
+	var v StmtVisitor = c
+	stmt.Accept(&v)
+}
+
+func (c *compiler) compileExpr(expr Expr) {
+	var v ExprVisitor = c
+	expr.Accept(&v)
+}
+
+func (c *compiler) compileArgs(args []Expr) {
+	for _, arg := range args {
+		c.compileExpr(arg)
+	}
+}
+
+// function compiles a function body into its own CompiledFunction and emits
+// the code to create a closure over it
+func (c *compiler) function(stmt Function, kind int) {
+	c.beginFunction(kind, stmt.Name.Lexeme)
+	c.beginScope()
+
+	c.current.function.Arity = len(stmt.Params)
+	for _, param := range stmt.Params {
+		c.token = param
+		c.declareVariable(param)
+		c.markInitialized()
+	}
+
+	for _, s := range stmt.Body {
+		c.compileStmt(s)
+	}
+
+	function, upvalues := c.endFunction()
+	c.emitShort(OP_CLOSURE, c.makeConstant(ObjectValue(function)))
+	for _, upvalue := range upvalues {
+		isLocal := byte(0)
+		if upvalue.isLocal {
+			isLocal = 1
+		}
+		c.emit(isLocal, byte(upvalue.index))
+	}
+}
+
+func (c *compiler) beginFunction(kind int, name string) {
+	state := &functionState{
+		enclosing: c.current,
+		function: &CompiledFunction{
+			Name:  name,
+			Chunk: &Chunk{},
+		},
+		kind: kind,
+	}
+
+	// Slot 0 holds the function being called, or the instance for methods
+	slotName := ""
+	if kind == functionMethod || kind == functionInitializer {
+		slotName = "this"
+	}
+	state.locals = append(state.locals, local{name: slotName})
+
+	c.current = state
+}
+
+func (c *compiler) endFunction() (*CompiledFunction, []upvalueRef) {
+	c.emitReturn()
+
+	state := c.current
+	state.function.UpvalueCount = len(state.upvalues)
+	c.current = state.enclosing
+
+	return state.function, state.upvalues
+}
+
+func (c *compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+// endScope pops the scope's locals off the stack, moving any that have been
+// captured by a closure onto the heap
+func (c *compiler) endScope() {
+	state := c.current
+	state.scopeDepth--
+
+	for len(state.locals) > 0 && state.locals[len(state.locals)-1].depth > state.scopeDepth {
+		if state.locals[len(state.locals)-1].isCaptured {
+			c.emit(OP_CLOSE_UPVALUE)
+		} else {
+			c.emit(OP_POP)
+		}
+		state.locals = state.locals[:len(state.locals)-1]
+	}
+}
+
+// parseVariable declares name, returning the constant holding the name if it's a global
+func (c *compiler) parseVariable(name Token) int {
+	c.declareVariable(name)
+	if c.current.scopeDepth > 0 {
+		return 0
+	}
+	return c.identifierConstant(name.Lexeme)
+}
+
+func (c *compiler) declareVariable(name Token) {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.addLocal(name.Lexeme)
+}
+
+func (c *compiler) addLocal(name string) {
+	if len(c.current.locals) == maxLocals {
+		c.error("too many local variables in function")
+		return
+	}
+	c.current.locals = append(c.current.locals, local{name: name, depth: -1})
+}
+
+func (c *compiler) markInitialized() {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.current.locals[len(c.current.locals)-1].depth = c.current.scopeDepth
+}
+
+func (c *compiler) defineVariable(global int) {
+	if c.current.scopeDepth > 0 {
+		c.markInitialized()
+		return
+	}
+	c.emitShort(OP_DEFINE_GLOBAL, global)
+}
+
+// namedVariable emits the code to read name, or to assign the value on top of the stack to it
+func (c *compiler) namedVariable(name Token, assign bool) {
+	getOp, setOp := byte(OP_GET_GLOBAL), byte(OP_SET_GLOBAL)
+
+	arg := resolveLocal(c.current, name.Lexeme)
+	if arg != -1 {
+		getOp, setOp = OP_GET_LOCAL, OP_SET_LOCAL
+	} else if arg = c.resolveUpvalue(c.current, name.Lexeme); arg != -1 {
+		getOp, setOp = OP_GET_UPVALUE, OP_SET_UPVALUE
+	} else {
+		if assign {
+			c.emitShort(OP_SET_GLOBAL, c.identifierConstant(name.Lexeme))
+		} else {
+			c.emitShort(OP_GET_GLOBAL, c.identifierConstant(name.Lexeme))
+		}
+		return
+	}
+
+	if assign {
+		c.emit(setOp, byte(arg))
+	} else {
+		c.emit(getOp, byte(arg))
+	}
+}
+
+func resolveLocal(state *functionState, name string) int {
+	for i := len(state.locals) - 1; i >= 0; i-- {
+		if state.locals[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveUpvalue looks for name in the enclosing functions, adding an
+// upvalue to each function in between so the variable is passed down
+func (c *compiler) resolveUpvalue(state *functionState, name string) int {
+	if state.enclosing == nil {
+		return -1
+	}
+
+	if local := resolveLocal(state.enclosing, name); local != -1 {
+		state.enclosing.locals[local].isCaptured = true
+		return c.addUpvalue(state, local, true)
+	}
+
+	if upvalue := c.resolveUpvalue(state.enclosing, name); upvalue != -1 {
+		return c.addUpvalue(state, upvalue, false)
+	}
+
+	return -1
+}
+
+func (c *compiler) addUpvalue(state *functionState, index int, isLocal bool) int {
+	for i, upvalue := range state.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return i
+		}
+	}
+
+	if len(state.upvalues) == maxUpvalues {
+		c.error("too many closure variables in function")
+		return 0
+	}
+
+	state.upvalues = append(state.upvalues, upvalueRef{index, isLocal})
+	return len(state.upvalues) - 1
+}
+
+func (c *compiler) chunk() *Chunk {
+	return c.current.function.Chunk
+}
+
+func (c *compiler) emit(bytes ...byte) {
+	for _, b := range bytes {
+		c.chunk().write(b, c.token.Line)
+	}
+}
+
+func (c *compiler) emitShort(op byte, operand int) {
+	c.emit(op, byte(operand>>8), byte(operand))
+}
+
+func (c *compiler) emitReturn() {
+	if c.current.kind == functionInitializer {
+		c.emit(OP_GET_LOCAL, 0)
+	} else {
+		c.emit(OP_NIL)
+	}
+	c.emit(OP_RETURN)
+}
+
+// emitJump emits a jump with a placeholder offset, returning where the offset is so it can be patched
+func (c *compiler) emitJump(op byte) int {
+	c.emit(op, 0xff, 0xff)
+	return len(c.chunk().Code) - 2
+}
+
+func (c *compiler) patchJump(offset int) {
+	jump := len(c.chunk().Code) - offset - 2
+	if jump > maxJump {
+		c.error("too much code to jump over")
+	}
+
+	c.chunk().Code[offset] = byte(jump >> 8)
+	c.chunk().Code[offset+1] = byte(jump)
+}
+
+func (c *compiler) emitLoop(loopStart int) {
+	offset := len(c.chunk().Code) - loopStart + 3
+	if offset > maxJump {
+		c.error("loop body too large")
+	}
+	c.emitShort(OP_LOOP, offset)
+}
+
+func (c *compiler) makeConstant(value Value) int {
+	constant := c.chunk().addConstant(value)
+	if constant >= maxConstants {
+		c.error("too many constants in one chunk")
+		return 0
+	}
+	return constant
+}
+
+func (c *compiler) identifierConstant(name string) int {
+	return c.makeConstant(StringValue(name))
+}
+
+func (c *compiler) error(message string) {
+	c.errors = append(c.errors, ParseError{
+		Token:   c.token,
+		Line:    c.token.Line,
+		Column:  c.token.Column,
+		Message: message,
+	})
+}
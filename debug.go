@@ -0,0 +1,145 @@
+package glox
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+var opNames = []string{
+	OP_CONSTANT:      "OP_CONSTANT",
+	OP_NIL:           "OP_NIL",
+	OP_TRUE:          "OP_TRUE",
+	OP_FALSE:         "OP_FALSE",
+	OP_POP:           "OP_POP",
+	OP_GET_LOCAL:     "OP_GET_LOCAL",
+	OP_SET_LOCAL:     "OP_SET_LOCAL",
+	OP_GET_GLOBAL:    "OP_GET_GLOBAL",
+	OP_DEFINE_GLOBAL: "OP_DEFINE_GLOBAL",
+	OP_SET_GLOBAL:    "OP_SET_GLOBAL",
+	OP_GET_UPVALUE:   "OP_GET_UPVALUE",
+	OP_SET_UPVALUE:   "OP_SET_UPVALUE",
+	OP_GET_PROPERTY:  "OP_GET_PROPERTY",
+	OP_SET_PROPERTY:  "OP_SET_PROPERTY",
+	OP_GET_SUPER:     "OP_GET_SUPER",
+	OP_EQUAL:         "OP_EQUAL",
+	OP_GREATER:       "OP_GREATER",
+	OP_GREATER_EQUAL: "OP_GREATER_EQUAL",
+	OP_LESS:          "OP_LESS",
+	OP_LESS_EQUAL:    "OP_LESS_EQUAL",
+	OP_ADD:           "OP_ADD",
+	OP_SUBTRACT:      "OP_SUBTRACT",
+	OP_MULTIPLY:      "OP_MULTIPLY",
+	OP_DIVIDE:        "OP_DIVIDE",
+	OP_POWER:         "OP_POWER",
+	OP_NOT:           "OP_NOT",
+	OP_NEGATE:        "OP_NEGATE",
+	OP_PRINT:         "OP_PRINT",
+	OP_JUMP:          "OP_JUMP",
+	OP_JUMP_IF_FALSE: "OP_JUMP_IF_FALSE",
+	OP_LOOP:          "OP_LOOP",
+	OP_CALL:          "OP_CALL",
+	OP_INVOKE:        "OP_INVOKE",
+	OP_SUPER_INVOKE:  "OP_SUPER_INVOKE",
+	OP_CLOSURE:       "OP_CLOSURE",
+	OP_CLOSE_UPVALUE: "OP_CLOSE_UPVALUE",
+	OP_RETURN:        "OP_RETURN",
+	OP_CLASS:         "OP_CLASS",
+	OP_INHERIT:       "OP_INHERIT",
+	OP_METHOD:        "OP_METHOD",
+}
+
+// Disassemble writes a readable listing of the bytecode of function, followed
+// by the listings of every function declared inside it
+func Disassemble(w io.Writer, function *CompiledFunction) {
+	fmt.Fprintf(w, "== %s ==\n", function)
+
+	chunk := function.Chunk
+	for offset := 0; offset < len(chunk.Code); {
+		offset = disassembleInstruction(w, chunk, offset)
+	}
+
+	for _, constant := range chunk.Constants {
+		if nested, isFunction := constant.AsObject().(*CompiledFunction); isFunction {
+			fmt.Fprintln(w)
+			Disassemble(w, nested)
+		}
+	}
+}
+
+// disassembleInstruction writes the instruction at offset and returns the offset of the next one
+func disassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	if offset > 0 && chunk.Lines[offset] == chunk.Lines[offset-1] {
+		fmt.Fprint(w, "   | ")
+	} else {
+		fmt.Fprintf(w, "%4d ", chunk.Lines[offset])
+	}
+
+	op := chunk.Code[offset]
+	if int(op) >= len(opNames) {
+		fmt.Fprintf(w, "unknown opcode %d\n", op)
+		return offset + 1
+	}
+	name := opNames[op]
+
+	switch op {
+	case OP_CONSTANT, OP_GET_GLOBAL, OP_DEFINE_GLOBAL, OP_SET_GLOBAL, OP_GET_PROPERTY, OP_SET_PROPERTY,
+		OP_GET_SUPER, OP_CLASS, OP_METHOD:
+		constant := chunk.readShort(offset + 1)
+		fmt.Fprintf(w, "%-16s %4d %s\n", name, constant, constantString(chunk.Constants[constant]))
+		return offset + 3
+	case OP_GET_LOCAL, OP_SET_LOCAL, OP_GET_UPVALUE, OP_SET_UPVALUE, OP_CALL:
+		fmt.Fprintf(w, "%-16s %4d\n", name, chunk.Code[offset+1])
+		return offset + 2
+	case OP_JUMP, OP_JUMP_IF_FALSE:
+		jump := chunk.readShort(offset + 1)
+		fmt.Fprintf(w, "%-16s %4d -> %d\n", name, offset, offset+3+jump)
+		return offset + 3
+	case OP_LOOP:
+		jump := chunk.readShort(offset + 1)
+		fmt.Fprintf(w, "%-16s %4d -> %d\n", name, offset, offset+3-jump)
+		return offset + 3
+	case OP_INVOKE, OP_SUPER_INVOKE:
+		constant := chunk.readShort(offset + 1)
+		argCount := chunk.Code[offset+3]
+		fmt.Fprintf(w, "%-16s (%d args) %4d %s\n", name, argCount, constant, constantString(chunk.Constants[constant]))
+		return offset + 4
+	case OP_CLOSURE:
+		constant := chunk.readShort(offset + 1)
+		function := chunk.Constants[constant].AsObject().(*CompiledFunction)
+		fmt.Fprintf(w, "%-16s %4d %s\n", name, constant, function)
+
+		offset += 3
+		for i := 0; i < function.UpvalueCount; i++ {
+			kind := "upvalue"
+			if chunk.Code[offset] == 1 {
+				kind = "local"
+			}
+			fmt.Fprintf(w, "%04d    |                     %s %d\n", offset, kind, chunk.Code[offset+1])
+			offset += 2
+		}
+		return offset
+	}
+
+	fmt.Fprintln(w, name)
+	return offset + 1
+}
+
+// constantString formats a constant so strings can be told apart from other values
+func constantString(value Value) string {
+	if value.IsString() {
+		return fmt.Sprintf("%q", value.AsString())
+	}
+	return value.String()
+}
+
+// traceStack writes the contents of the VM's stack on one line
+func traceStack(w io.Writer, stack []Value) {
+	var b strings.Builder
+	b.WriteString("          ")
+	for _, value := range stack {
+		fmt.Fprintf(&b, "[ %s ]", constantString(value))
+	}
+	fmt.Fprintln(w, b.String())
+}
@@ -1,39 +1,67 @@
 package glox
 
+import "fmt"
+
+// Environment holds the local variables of one scope. The Resolver gives
+// each variable a slot, its index in Values, in the order the scope
+// declares them, so variables are defined by appending to Values
 type Environment struct {
 	Enclosing *Environment
-	Values    map[string]interface{}
+	Values    []Value
 }
 
-func (env *Environment) define(name string, value interface{}) {
-	if env.Values == nil {
-		env.Values = make(map[string]interface{})
-	}
-	env.Values[name] = value
+// globalDepth is the Depth of the Slot of a variable that isn't local
+const globalDepth = -1
+
+// Slot is where the Resolver found a local variable: how many scopes out
+// from its use it was declared and its index in that scope's Values
+type Slot struct {
+	Depth int
+	Index int
 }
 
-func (env *Environment) assign(name Token, value interface{}) {
-	if env.Values != nil {
-		if _, hasKey := env.Values[name.Lexeme]; hasKey {
-			env.Values[name.Lexeme] = value
-		}
-	}
+func (env *Environment) define(value Value) {
+	env.Values = append(env.Values, value)
+}
 
-	if env.Enclosing != nil {
-		env.Enclosing.assign(name, value)
+// ancestor returns the environment distance scopes out from env
+func (env *Environment) ancestor(distance int) *Environment {
+	ancestor := env
+	for i := 0; i < distance; i++ {
+		ancestor = ancestor.Enclosing
 	}
+
+	return ancestor
+}
+
+func (env *Environment) getAt(slot Slot) Value {
+	return env.ancestor(slot.Depth).Values[slot.Index]
+}
+
+func (env *Environment) assignAt(slot Slot, value Value) {
+	env.ancestor(slot.Depth).Values[slot.Index] = value
 }
 
-func (env *Environment) get(name Token) interface{} {
-	//fmt.Println(env)
-	if env.Values != nil {
-		if _, hasKey := env.Values[name.Lexeme]; hasKey {
-			return env.Values[name.Lexeme]
-		}
+// define creates a variable in the current scope, or a global at the top level
+func (intr *Interpreter) define(name string, value Value) {
+	if intr.Env == nil {
+		intr.Globals[name] = value
+		return
 	}
-	if env.Enclosing != nil {
-		return env.Enclosing.get(name)
+	intr.Env.define(value)
+}
+
+func (intr *Interpreter) getGlobal(name Token) Value {
+	value, defined := intr.Globals[name.Lexeme]
+	if !defined {
+		panic(RuntimeError{name, fmt.Sprintf("undefined variable '%s'", name.Lexeme)})
 	}
+	return value
+}
 
-	return nil
+func (intr *Interpreter) assignGlobal(name Token, value Value) {
+	if _, defined := intr.Globals[name.Lexeme]; !defined {
+		panic(RuntimeError{name, fmt.Sprintf("undefined variable '%s'", name.Lexeme)})
+	}
+	intr.Globals[name.Lexeme] = value
 }
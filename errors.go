@@ -0,0 +1,132 @@
+package glox
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseError is an error found before a program is run, either a syntax
+// error from the Scanner or Parser or a static error from the Resolver
+type ParseError struct {
+	Token   Token
+	Line    int
+	Column  int
+	Message string
+
+	// Unterminated is set on a string the source ended in the middle of,
+	// which more source could close
+	Unterminated bool
+}
+
+func (err ParseError) Error() string {
+	where := fmt.Sprintf("at \"%s\"", err.Token.Lexeme)
+	if err.Token.TokenType == EOF {
+		where = "at end"
+	}
+
+	return fmt.Sprintf("error on line %v:%v %s: %s", err.Line, err.Column, where, err.Message)
+}
+
+// ParseErrors is every error found in a source, one per line
+type ParseErrors []ParseError
+
+func (errs ParseErrors) Error() string {
+	var lines []string
+	for _, err := range errs {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RuntimeError is an error raised while running a Lox program
+type RuntimeError struct {
+	Token   Token
+	Message string
+}
+
+func (err RuntimeError) Error() string {
+	if err.Token.Line == 0 {
+		return fmt.Sprintf("runtime error: %s", err.Message)
+	}
+	if err.Token.Lexeme == "" {
+		return fmt.Sprintf("runtime error on line %v: %s", err.Token.Line, err.Message)
+	}
+	return fmt.Sprintf("runtime error on line %v at \"%s\": %s", err.Token.Line, err.Token.Lexeme, err.Message)
+}
+
+// StackOverflowError is the runtime error returned when calls nest deeper
+// than the interpreter's MaxCallDepth allows
+type StackOverflowError struct {
+	RuntimeError
+}
+
+func (err StackOverflowError) Unwrap() error {
+	return err.RuntimeError
+}
+
+// AllocationError is the runtime error returned when a program allocates
+// more strings and instances than the interpreter's MaxAllocation allows.
+// Allocated is roughly how many bytes it had allocated
+type AllocationError struct {
+	RuntimeError
+	Allocated int
+}
+
+func (err AllocationError) Unwrap() error {
+	return err.RuntimeError
+}
+
+// nativeError is the runtime error for err returned by a native called at
+// token. A runtime error that already has a token, from Lox code the native
+// called back into, is kept as it is rather than wrapped in another
+func nativeError(token Token, err error) RuntimeError {
+	if runtimeErr, isRuntimeErr := err.(RuntimeError); isRuntimeErr && runtimeErr.Token.Line != 0 {
+		return runtimeErr
+	}
+	return RuntimeError{token, err.Error()}
+}
+
+// recoverRuntimeError stops a RuntimeError raised by the interpreter from
+// unwinding any further and stores it in err, any other panic is passed on
+func recoverRuntimeError(err *error) {
+	if r := recover(); r != nil {
+		runtimeErr, isRuntimeErr := r.(RuntimeError)
+		if !isRuntimeErr {
+			panic(r)
+		}
+		*err = runtimeErr
+	}
+}
+
+// recoverError is recoverRuntimeError for where Go calls into Lox, it also
+// stops a program that ran out of budget or was cancelled, storing the
+// reason in err
+func recoverError(err *error) {
+	if r := recover(); r != nil {
+		if stop, isStop := r.(stopError); isStop {
+			*err = stop.err
+			return
+		}
+		runtimeErr, isRuntimeErr := r.(RuntimeError)
+		if !isRuntimeErr {
+			panic(r)
+		}
+		*err = runtimeErr
+	}
+}
+
+// Reporter is sent the errors found in a program, whether syntax errors,
+// static errors from the Resolver or runtime errors
+type Reporter interface {
+	Report(err error)
+}
+
+// WriterReporter reports errors by writing each one on its own line to W
+type WriterReporter struct {
+	W io.Writer
+}
+
+func (reporter WriterReporter) Report(err error) {
+	fmt.Fprintln(reporter.W, err)
+}
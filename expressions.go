@@ -7,8 +7,14 @@ type Expr interface {
 type ExprVisitor interface {
     VisitAssignExpr(Assign) interface{}
     VisitBinaryExpr(Binary) interface{}
+    VisitCallExpr(Call) interface{}
+    VisitGetExpr(Get) interface{}
     VisitGroupingExpr(Grouping) interface{}
     VisitLiteralExpr(Literal) interface{}
+    VisitLogicalExpr(Logical) interface{}
+    VisitSetExpr(Set) interface{}
+    VisitSuperExpr(Super) interface{}
+    VisitThisExpr(This) interface{}
     VisitUnaryExpr(Unary) interface{}
     VisitVariableExpr(Variable) interface{}
 }
@@ -16,6 +22,7 @@ type ExprVisitor interface {
 type Assign struct {
     Name Token
     Value Expr
+    ID int
 }
 func (me Assign) Accept(visitor *ExprVisitor) interface{} {
     v := *visitor
@@ -32,6 +39,25 @@ func (me Binary) Accept(visitor *ExprVisitor) interface{} {
     return v.VisitBinaryExpr(me)
 }
 
+type Call struct {
+    Callee Expr
+    Paren Token
+    Arguments []Expr
+}
+func (me Call) Accept(visitor *ExprVisitor) interface{} {
+    v := *visitor
+    return v.VisitCallExpr(me)
+}
+
+type Get struct {
+    Object Expr
+    Name Token
+}
+func (me Get) Accept(visitor *ExprVisitor) interface{} {
+    v := *visitor
+    return v.VisitGetExpr(me)
+}
+
 type Grouping struct {
     Expression Expr
 }
@@ -41,13 +67,53 @@ func (me Grouping) Accept(visitor *ExprVisitor) interface{} {
 }
 
 type Literal struct {
-    Value interface{}
+    Value Value
+    Token Token
 }
 func (me Literal) Accept(visitor *ExprVisitor) interface{} {
     v := *visitor
     return v.VisitLiteralExpr(me)
 }
 
+type Logical struct {
+    Left Expr
+    Operator Token
+    Right Expr
+}
+func (me Logical) Accept(visitor *ExprVisitor) interface{} {
+    v := *visitor
+    return v.VisitLogicalExpr(me)
+}
+
+type Set struct {
+    Object Expr
+    Name Token
+    Value Expr
+}
+func (me Set) Accept(visitor *ExprVisitor) interface{} {
+    v := *visitor
+    return v.VisitSetExpr(me)
+}
+
+type Super struct {
+    Keyword Token
+    Method Token
+    ID int
+}
+func (me Super) Accept(visitor *ExprVisitor) interface{} {
+    v := *visitor
+    return v.VisitSuperExpr(me)
+}
+
+type This struct {
+    Keyword Token
+    ID int
+}
+func (me This) Accept(visitor *ExprVisitor) interface{} {
+    v := *visitor
+    return v.VisitThisExpr(me)
+}
+
 type Unary struct {
     Operator Token
     Right Expr
@@ -59,6 +125,7 @@ func (me Unary) Accept(visitor *ExprVisitor) interface{} {
 
 type Variable struct {
     Name Token
+    ID int
 }
 func (me Variable) Accept(visitor *ExprVisitor) interface{} {
     v := *visitor
@@ -10,12 +10,18 @@ import (
 
 func main() {
 	exprAst := defineAst("Expr", []string{
-		"Assign : Name Token, Value Expr",
+		"Assign : Name Token, Value Expr, ID int",
 		"Binary : Left Expr, Operator Token, Right Expr",
+		"Call : Callee Expr, Paren Token, Arguments []Expr",
+		"Get : Object Expr, Name Token",
 		"Grouping : Expression Expr",
-		"Literal : Value interface{}",
+		"Literal : Value Value, Token Token",
+		"Logical : Left Expr, Operator Token, Right Expr",
+		"Set : Object Expr, Name Token, Value Expr",
+		"Super : Keyword Token, Method Token, ID int",
+		"This : Keyword Token, ID int",
 		"Unary : Operator Token, Right Expr",
-		"Variable : Name Token",
+		"Variable : Name Token, ID int",
 	})
 
 	file, err := os.Create("expressions.go")
@@ -31,10 +37,14 @@ func main() {
 
 	stmtAst := defineAst("Stmt", []string{
 		"Block : Statements []Stmt",
+		"Class : Name Token, Superclass *Variable, Methods []Function, ID int",
 		"Expression : Expression Expr",
-		"Print : Expression Expr",
-		"Var : Name Token, Initializer Expr",
-		"While : Condition Expr, Body Stmt",
+		"Function : Name Token, Params []Token, Body []Stmt, ID int",
+		"If : Keyword Token, Condition Expr, ThenBranch Stmt, ElseBranch Stmt",
+		"Print : Keyword Token, Expression Expr",
+		"Return : Keyword Token, Value Expr",
+		"Var : Name Token, Initializer Expr, ID int",
+		"While : Keyword Token, Condition Expr, Body Stmt",
 	})
 
 	file, err = os.Create("statements.go")
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"github.com/arowshot/glox"
+)
+
+// AstJSON turns syntax trees into maps and slices that encoding/json can
+// write out. Every node becomes an object with a "type" naming the node
+type AstJSON struct {
+}
+
+type node map[string]interface{}
+
+func (ast AstJSON) VisitAssignExpr(expr glox.Assign) interface{} {
+	return node{"type": "Assign", "name": expr.Name.Lexeme, "value": ast.expr(expr.Value)}
+}
+func (ast AstJSON) VisitBinaryExpr(expr glox.Binary) interface{} {
+	return node{"type": "Binary", "operator": expr.Operator.Lexeme, "left": ast.expr(expr.Left), "right": ast.expr(expr.Right)}
+}
+func (ast AstJSON) VisitCallExpr(expr glox.Call) interface{} {
+	return node{"type": "Call", "callee": ast.expr(expr.Callee), "arguments": ast.exprs(expr.Arguments)}
+}
+func (ast AstJSON) VisitGetExpr(expr glox.Get) interface{} {
+	return node{"type": "Get", "object": ast.expr(expr.Object), "name": expr.Name.Lexeme}
+}
+func (ast AstJSON) VisitGroupingExpr(expr glox.Grouping) interface{} {
+	return node{"type": "Grouping", "expression": ast.expr(expr.Expression)}
+}
+func (ast AstJSON) VisitLiteralExpr(expr glox.Literal) interface{} {
+	var value interface{}
+	switch expr.Value.Type() {
+	case glox.VAL_BOOL:
+		value = expr.Value.AsBool()
+	case glox.VAL_NUMBER:
+		value = expr.Value.AsNumber()
+	case glox.VAL_STRING:
+		value = expr.Value.AsString()
+	}
+	return node{"type": "Literal", "value": value}
+}
+func (ast AstJSON) VisitLogicalExpr(expr glox.Logical) interface{} {
+	return node{"type": "Logical", "operator": expr.Operator.Lexeme, "left": ast.expr(expr.Left), "right": ast.expr(expr.Right)}
+}
+func (ast AstJSON) VisitSetExpr(expr glox.Set) interface{} {
+	return node{"type": "Set", "object": ast.expr(expr.Object), "name": expr.Name.Lexeme, "value": ast.expr(expr.Value)}
+}
+func (ast AstJSON) VisitSuperExpr(expr glox.Super) interface{} {
+	return node{"type": "Super", "method": expr.Method.Lexeme}
+}
+func (ast AstJSON) VisitThisExpr(expr glox.This) interface{} {
+	return node{"type": "This"}
+}
+func (ast AstJSON) VisitUnaryExpr(expr glox.Unary) interface{} {
+	return node{"type": "Unary", "operator": expr.Operator.Lexeme, "right": ast.expr(expr.Right)}
+}
+func (ast AstJSON) VisitVariableExpr(expr glox.Variable) interface{} {
+	return node{"type": "Variable", "name": expr.Name.Lexeme}
+}
+
+func (ast AstJSON) VisitBlockStmt(stmt glox.Block) interface{} {
+	return node{"type": "Block", "statements": ast.stmts(stmt.Statements)}
+}
+func (ast AstJSON) VisitClassStmt(stmt glox.Class) interface{} {
+	var superclass interface{}
+	if stmt.Superclass != nil {
+		superclass = ast.expr(*stmt.Superclass)
+	}
+
+	methods := []interface{}{}
+	for _, method := range stmt.Methods {
+		methods = append(methods, ast.stmt(method))
+	}
+	return node{"type": "Class", "name": stmt.Name.Lexeme, "superclass": superclass, "methods": methods}
+}
+func (ast AstJSON) VisitExpressionStmt(stmt glox.Expression) interface{} {
+	return node{"type": "Expression", "expression": ast.expr(stmt.Expression)}
+}
+func (ast AstJSON) VisitFunctionStmt(stmt glox.Function) interface{} {
+	params := []string{}
+	for _, param := range stmt.Params {
+		params = append(params, param.Lexeme)
+	}
+	return node{"type": "Function", "name": stmt.Name.Lexeme, "params": params, "body": ast.stmts(stmt.Body)}
+}
+func (ast AstJSON) VisitIfStmt(stmt glox.If) interface{} {
+	return node{"type": "If", "condition": ast.expr(stmt.Condition), "then": ast.stmt(stmt.ThenBranch), "else": ast.stmt(stmt.ElseBranch)}
+}
+func (ast AstJSON) VisitPrintStmt(stmt glox.Print) interface{} {
+	return node{"type": "Print", "expression": ast.expr(stmt.Expression)}
+}
+func (ast AstJSON) VisitReturnStmt(stmt glox.Return) interface{} {
+	return node{"type": "Return", "value": ast.expr(stmt.Value)}
+}
+func (ast AstJSON) VisitVarStmt(stmt glox.Var) interface{} {
+	return node{"type": "Var", "name": stmt.Name.Lexeme, "initializer": ast.expr(stmt.Initializer)}
+}
+func (ast AstJSON) VisitWhileStmt(stmt glox.While) interface{} {
+	return node{"type": "While", "condition": ast.expr(stmt.Condition), "body": ast.stmt(stmt.Body)}
+}
+
+// expr converts expr, leaving missing expressions as null
+func (ast AstJSON) expr(expr glox.Expr) interface{} {
+	if expr == nil {
+		return nil
+	}
+	var v glox.ExprVisitor = ast
+	return expr.Accept(&v)
+}
+func (ast AstJSON) exprs(exprs []glox.Expr) []interface{} {
+	nodes := []interface{}{}
+	for _, expr := range exprs {
+		nodes = append(nodes, ast.expr(expr))
+	}
+	return nodes
+}
+func (ast AstJSON) stmt(stmt glox.Stmt) interface{} {
+	if stmt == nil {
+		return nil
+	}
+	var v glox.StmtVisitor = ast
+	return stmt.Accept(&v)
+}
+func (ast AstJSON) stmts(stmts []glox.Stmt) []interface{} {
+	nodes := []interface{}{}
+	for _, stmt := range stmts {
+		nodes = append(nodes, ast.stmt(stmt))
+	}
+	return nodes
+}
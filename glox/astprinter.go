@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	"github.com/arowshot/glox"
 )
@@ -13,11 +14,29 @@ type AstPrinter struct {
 func (ast AstPrinter) VisitBinaryExpr(expr glox.Binary) interface{} {
 	return ast.parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right)
 }
+func (ast AstPrinter) VisitCallExpr(expr glox.Call) interface{} {
+	return ast.parenthesize("call", append([]glox.Expr{expr.Callee}, expr.Arguments...)...)
+}
+func (ast AstPrinter) VisitGetExpr(expr glox.Get) interface{} {
+	return ast.parenthesize(fmt.Sprintf("get %v", expr.Name.Lexeme), expr.Object)
+}
 func (ast AstPrinter) VisitGroupingExpr(expr glox.Grouping) interface{} {
 	return ast.parenthesize("group", expr.Expression)
 }
 func (ast AstPrinter) VisitLiteralExpr(expr glox.Literal) interface{} {
-	return fmt.Sprintf("%v", expr.Value)
+	return expr.Value.String()
+}
+func (ast AstPrinter) VisitLogicalExpr(expr glox.Logical) interface{} {
+	return ast.parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right)
+}
+func (ast AstPrinter) VisitSetExpr(expr glox.Set) interface{} {
+	return ast.parenthesize(fmt.Sprintf("set %v", expr.Name.Lexeme), expr.Object, expr.Value)
+}
+func (ast AstPrinter) VisitSuperExpr(expr glox.Super) interface{} {
+	return fmt.Sprintf("(super %v)", expr.Method.Lexeme)
+}
+func (ast AstPrinter) VisitThisExpr(expr glox.This) interface{} {
+	return "this"
 }
 func (ast AstPrinter) VisitUnaryExpr(expr glox.Unary) interface{} {
 	return ast.parenthesize(expr.Operator.Lexeme, expr.Right)
@@ -26,15 +45,72 @@ func (ast AstPrinter) VisitVariableExpr(expr glox.Variable) interface{} {
 	return fmt.Sprintf("(var %v)", expr.Name.Lexeme)
 }
 func (ast AstPrinter) VisitAssignExpr(expr glox.Assign) interface{} {
-	return ast.parenthesize(fmt.Sprintf("assign %v", expr.Name.Lexeme), expr)
+	return ast.parenthesize(fmt.Sprintf("assign %v", expr.Name.Lexeme), expr.Value)
+}
+
+func (ast AstPrinter) VisitBlockStmt(stmt glox.Block) interface{} {
+	return ast.parenthesizeStmts("block", stmt.Statements...)
+}
+func (ast AstPrinter) VisitClassStmt(stmt glox.Class) interface{} {
+	name := fmt.Sprintf("class %v", stmt.Name.Lexeme)
+	if stmt.Superclass != nil {
+		name += fmt.Sprintf(" < %v", stmt.Superclass.Name.Lexeme)
+	}
+
+	var methods []glox.Stmt
+	for _, method := range stmt.Methods {
+		methods = append(methods, method)
+	}
+	return ast.parenthesizeStmts(name, methods...)
+}
+func (ast AstPrinter) VisitExpressionStmt(stmt glox.Expression) interface{} {
+	return ast.parenthesize(";", stmt.Expression)
+}
+func (ast AstPrinter) VisitFunctionStmt(stmt glox.Function) interface{} {
+	var params []string
+	for _, param := range stmt.Params {
+		params = append(params, param.Lexeme)
+	}
+	return ast.parenthesizeStmts(fmt.Sprintf("fun %v(%v)", stmt.Name.Lexeme, strings.Join(params, " ")), stmt.Body...)
+}
+func (ast AstPrinter) VisitIfStmt(stmt glox.If) interface{} {
+	if stmt.ElseBranch == nil {
+		return fmt.Sprintf("(if %s %s)", ast.print(stmt.Condition), ast.printStmt(stmt.ThenBranch))
+	}
+	return fmt.Sprintf("(if %s %s %s)", ast.print(stmt.Condition), ast.printStmt(stmt.ThenBranch), ast.printStmt(stmt.ElseBranch))
+}
+func (ast AstPrinter) VisitPrintStmt(stmt glox.Print) interface{} {
+	return ast.parenthesize("print", stmt.Expression)
+}
+func (ast AstPrinter) VisitReturnStmt(stmt glox.Return) interface{} {
+	if stmt.Value == nil {
+		return "(return)"
+	}
+	return ast.parenthesize("return", stmt.Value)
+}
+func (ast AstPrinter) VisitVarStmt(stmt glox.Var) interface{} {
+	if stmt.Initializer == nil {
+		return fmt.Sprintf("(define %v)", stmt.Name.Lexeme)
+	}
+	return ast.parenthesize(fmt.Sprintf("define %v", stmt.Name.Lexeme), stmt.Initializer)
+}
+func (ast AstPrinter) VisitWhileStmt(stmt glox.While) interface{} {
+	return fmt.Sprintf("(while %s %s)", ast.print(stmt.Condition), ast.printStmt(stmt.Body))
 }
 func (ast *AstPrinter) visitor() *glox.ExprVisitor {
 	var v glox.ExprVisitor = *ast
 	return &v
 }
+func (ast *AstPrinter) stmtVisitor() *glox.StmtVisitor {
+	var v glox.StmtVisitor = *ast
+	return &v
+}
 func (ast *AstPrinter) print(expr glox.Expr) string {
 	return fmt.Sprintf("%v", expr.Accept(ast.visitor()))
 }
+func (ast *AstPrinter) printStmt(stmt glox.Stmt) string {
+	return fmt.Sprintf("%v", stmt.Accept(ast.stmtVisitor()))
+}
 
 func (ast AstPrinter) parenthesize(name string, exprs ...glox.Expr) string {
 	writer := bytes.NewBufferString("")
@@ -47,3 +123,15 @@ func (ast AstPrinter) parenthesize(name string, exprs ...glox.Expr) string {
 
 	return writer.String()
 }
+
+func (ast AstPrinter) parenthesizeStmts(name string, stmts ...glox.Stmt) string {
+	writer := bytes.NewBufferString("")
+
+	fmt.Fprintf(writer, "(%s", name)
+	for _, stmt := range stmts {
+		fmt.Fprintf(writer, " %s", stmt.Accept(ast.stmtVisitor()))
+	}
+	fmt.Fprint(writer, ")")
+
+	return writer.String()
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// errInterrupted is returned from ReadLine when the user presses Ctrl-C
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads input a line at a time, showing prompt first
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader reads lines with no editing, it's used when input isn't a terminal
+type plainReader struct {
+	scanner *bufio.Scanner
+}
+
+func (reader *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	if !reader.scanner.Scan() {
+		fmt.Println()
+		if err := reader.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return reader.scanner.Text(), nil
+}
+
+// Keys the editor handles. Escape sequences for the arrow keys and friends
+// are translated into the control key that does the same thing
+const (
+	keyDelete = -1
+
+	ctrlA     = 1
+	ctrlB     = 2
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlE     = 5
+	ctrlF     = 6
+	ctrlG     = 7
+	ctrlH     = 8
+	keyTab    = 9
+	ctrlK     = 11
+	ctrlL     = 12
+	keyEnter  = 13
+	ctrlN     = 14
+	ctrlP     = 16
+	ctrlR     = 18
+	ctrlU     = 21
+	ctrlW     = 23
+	keyEscape = 27
+	keyBack   = 127
+)
+
+const maxHistory = 1000
+
+// LineEditor reads lines from a terminal in raw mode, with cursor movement,
+// history that is saved between sessions, reverse history search with
+// Ctrl-R and tab completion
+type LineEditor struct {
+	In          *os.File
+	Out         io.Writer
+	HistoryFile string
+
+	// Complete returns the possible completions of the word before the cursor
+	Complete func(prefix string) []string
+
+	history      []string
+	historyError bool // Set once a failure to save the history has been reported
+	reader       *bufio.Reader
+}
+
+// editState is the line currently being edited
+type editState struct {
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+func (state *editState) insert(runes ...rune) {
+	buf := append([]rune{}, state.buf[:state.pos]...)
+	buf = append(buf, runes...)
+	state.buf = append(buf, state.buf[state.pos:]...)
+	state.pos += len(runes)
+}
+
+func (state *editState) set(line string) {
+	state.buf = []rune(line)
+	state.pos = len(state.buf)
+}
+
+func (state *editState) backspace() {
+	if state.pos > 0 {
+		state.buf = append(state.buf[:state.pos-1], state.buf[state.pos:]...)
+		state.pos--
+	}
+}
+
+func (state *editState) delete() {
+	if state.pos < len(state.buf) {
+		state.buf = append(state.buf[:state.pos], state.buf[state.pos+1:]...)
+	}
+}
+
+// deleteWord deletes the word before the cursor along with any spaces after it
+func (state *editState) deleteWord() {
+	start := state.pos
+	for start > 0 && state.buf[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && state.buf[start-1] != ' ' {
+		start--
+	}
+	state.buf = append(state.buf[:start], state.buf[state.pos:]...)
+	state.pos = start
+}
+
+// LoadHistory reads previous sessions' history from HistoryFile, a missing
+// file is not an error. A file with more than maxHistory lines is cut down
+// to the latest ones, since each session only appends to it
+func (ed *LineEditor) LoadHistory() error {
+	if ed.HistoryFile == "" {
+		return nil
+	}
+
+	file, err := os.Open(ed.HistoryFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if scanner.Text() != "" {
+			ed.history = append(ed.history, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(ed.history) <= maxHistory {
+		return nil
+	}
+	ed.history = ed.history[len(ed.history)-maxHistory:]
+	return ioutil.WriteFile(ed.HistoryFile, []byte(strings.Join(ed.history, "\n")+"\n"), 0600)
+}
+
+// addHistory remembers line and appends it to the history file straight
+// away, so nothing is lost if the session ends abruptly
+func (ed *LineEditor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(ed.history) > 0 && ed.history[len(ed.history)-1] == line {
+		return
+	}
+
+	ed.history = append(ed.history, line)
+	if len(ed.history) > maxHistory {
+		ed.history = ed.history[1:]
+	}
+
+	if ed.HistoryFile == "" {
+		return
+	}
+	if err := appendLine(ed.HistoryFile, line); err != nil && !ed.historyError {
+		ed.historyError = true
+		fmt.Fprintf(os.Stderr, "can't save history: %v\n", err)
+	}
+}
+
+// appendLine adds line to the end of the file called name, creating it if need be
+func appendLine(name, line string) error {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(file, line); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ReadLine shows prompt and lets the user edit a line until they press
+// enter. io.EOF is returned for Ctrl-D on an empty line and errInterrupted
+// for Ctrl-C
+func (ed *LineEditor) ReadLine(prompt string) (string, error) {
+	restore, err := enableRawMode(int(ed.In.Fd()))
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	if ed.reader == nil {
+		ed.reader = bufio.NewReader(ed.In)
+	}
+
+	state := &editState{prompt: prompt}
+	historyIndex := len(ed.history)
+	var editing string // The new line, kept while browsing through history
+
+	for {
+		ed.refresh(state)
+
+		key, err := ed.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, '\n':
+			fmt.Fprint(ed.Out, "\n")
+			line := string(state.buf)
+			ed.addHistory(line)
+			return line, nil
+		case ctrlC:
+			fmt.Fprint(ed.Out, "^C\n")
+			return "", errInterrupted
+		case ctrlD:
+			if len(state.buf) == 0 {
+				fmt.Fprint(ed.Out, "\n")
+				return "", io.EOF
+			}
+			state.delete()
+		case keyDelete:
+			state.delete()
+		case keyBack, ctrlH:
+			state.backspace()
+		case ctrlA:
+			state.pos = 0
+		case ctrlE:
+			state.pos = len(state.buf)
+		case ctrlB:
+			if state.pos > 0 {
+				state.pos--
+			}
+		case ctrlF:
+			if state.pos < len(state.buf) {
+				state.pos++
+			}
+		case ctrlK:
+			state.buf = state.buf[:state.pos]
+		case ctrlU:
+			state.buf = state.buf[state.pos:]
+			state.pos = 0
+		case ctrlW:
+			state.deleteWord()
+		case ctrlL:
+			fmt.Fprint(ed.Out, "\x1b[H\x1b[2J")
+		case ctrlP:
+			if historyIndex > 0 {
+				if historyIndex == len(ed.history) {
+					editing = string(state.buf)
+				}
+				historyIndex--
+				state.set(ed.history[historyIndex])
+			}
+		case ctrlN:
+			if historyIndex < len(ed.history) {
+				historyIndex++
+				if historyIndex == len(ed.history) {
+					state.set(editing)
+				} else {
+					state.set(ed.history[historyIndex])
+				}
+			}
+		case ctrlR:
+			submit, err := ed.search(state)
+			if err != nil {
+				return "", err
+			}
+			if submit {
+				ed.refresh(state)
+				fmt.Fprint(ed.Out, "\n")
+				line := string(state.buf)
+				ed.addHistory(line)
+				return line, nil
+			}
+		case keyTab:
+			ed.complete(state)
+		default:
+			if key > 0 && unicode.IsPrint(key) {
+				state.insert(key)
+			}
+		}
+	}
+}
+
+// readKey reads one key press, turning escape sequences into the matching control key
+func (ed *LineEditor) readKey() (rune, error) {
+	r, _, err := ed.reader.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	next, _, err := ed.reader.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if next != '[' && next != 'O' {
+		return 0, nil
+	}
+
+	// Read the parameters up to the final byte of the sequence
+	var params []rune
+	for {
+		c, _, err := ed.reader.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if c >= 0x40 && c <= 0x7e {
+			switch c {
+			case 'A':
+				return ctrlP, nil
+			case 'B':
+				return ctrlN, nil
+			case 'C':
+				return ctrlF, nil
+			case 'D':
+				return ctrlB, nil
+			case 'H':
+				return ctrlA, nil
+			case 'F':
+				return ctrlE, nil
+			case '~':
+				switch string(params) {
+				case "1", "7":
+					return ctrlA, nil
+				case "4", "8":
+					return ctrlE, nil
+				case "3":
+					return keyDelete, nil
+				}
+			}
+			return 0, nil
+		}
+		params = append(params, c)
+	}
+}
+
+// refresh redraws the prompt and line and puts the cursor back where it belongs
+func (ed *LineEditor) refresh(state *editState) {
+	fmt.Fprintf(ed.Out, "\r%s%s\x1b[K", state.prompt, string(state.buf))
+	if back := len(state.buf) - state.pos; back > 0 {
+		fmt.Fprintf(ed.Out, "\x1b[%dD", back)
+	}
+}
+
+// search lets the user search backwards through history for lines
+// containing what they type. The match found is put into state, and true is
+// returned if enter was pressed to run it straight away
+func (ed *LineEditor) search(state *editState) (bool, error) {
+	var query []rune
+	index := len(ed.history)
+	match := string(state.buf)
+
+	for {
+		fmt.Fprintf(ed.Out, "\r(reverse-i-search)`%s': %s\x1b[K", string(query), match)
+
+		r, _, err := ed.reader.ReadRune()
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case r == ctrlR:
+			if i := ed.findHistory(string(query), index-1); i >= 0 {
+				index = i
+				match = ed.history[i]
+			}
+		case r == keyBack || r == ctrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				index = len(ed.history)
+				if i := ed.findHistory(string(query), index-1); i >= 0 {
+					index = i
+					match = ed.history[i]
+				}
+			}
+		case r == ctrlG || r == ctrlC:
+			return false, nil
+		case r == keyEnter || r == '\n':
+			state.set(match)
+			return true, nil
+		case unicode.IsPrint(r):
+			query = append(query, r)
+			from := index
+			if from == len(ed.history) {
+				from--
+			}
+			if i := ed.findHistory(string(query), from); i >= 0 {
+				index = i
+				match = ed.history[i]
+			}
+		default:
+			if r == keyEscape {
+				ed.reader.UnreadRune()
+				ed.readKey()
+			}
+			state.set(match)
+			return false, nil
+		}
+	}
+}
+
+// findHistory returns the index of the newest history entry at or before from that contains query, or -1
+func (ed *LineEditor) findHistory(query string, from int) int {
+	for i := from; i >= 0; i-- {
+		if strings.Contains(ed.history[i], query) {
+			return i
+		}
+	}
+	return -1
+}
+
+// complete finishes the word before the cursor. If there's more than one
+// way to do so it goes as far as they agree and lists them all
+func (ed *LineEditor) complete(state *editState) {
+	if ed.Complete == nil {
+		return
+	}
+
+	start := state.pos
+	for start > 0 && (unicode.IsLetter(state.buf[start-1]) || unicode.IsDigit(state.buf[start-1]) || state.buf[start-1] == '_') {
+		start--
+	}
+	prefix := string(state.buf[start:state.pos])
+	if prefix == "" {
+		return
+	}
+
+	candidates := ed.Complete(prefix)
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, common) {
+			common = common[:len(common)-1]
+		}
+	}
+
+	if len(common) > len(prefix) {
+		state.insert([]rune(common[len(prefix):])...)
+		return
+	}
+
+	if len(candidates) > 1 {
+		fmt.Fprintf(ed.Out, "\n%s\n", strings.Join(candidates, "  "))
+	}
+}
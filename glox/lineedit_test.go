@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadHistoryTrimsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var lines []string
+	for i := 0; i < maxHistory+10; i++ {
+		lines = append(lines, fmt.Sprintf("print %d;", i))
+	}
+	name := filepath.Join(dir, "history")
+	if err := ioutil.WriteFile(name, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ed := &LineEditor{HistoryFile: name}
+	if err := ed.LoadHistory(); err != nil {
+		t.Fatal(err)
+	}
+	ed.addHistory("print \"new\";")
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	if len(saved) != maxHistory+1 || saved[0] != lines[10] || saved[len(saved)-1] != "print \"new\";" {
+		t.Errorf("history file has %d lines from %q to %q", len(saved), saved[0], saved[len(saved)-1])
+	}
+}
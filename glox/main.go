@@ -2,66 +2,377 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/arowshot/glox"
 )
 
+// Exit codes, following sysexits.h like the reference implementation
+const (
+	exitUsage    = 64
+	exitDataErr  = 65
+	exitNoInput  = 66
+	exitSoftware = 70
+	exitIOErr    = 74
+)
+
+var (
+	dumpTokens  = flag.Bool("tokens", false, "print the tokens in the script instead of running it")
+	dumpAst     = flag.Bool("ast", false, "print the syntax tree of the script instead of running it")
+	dumpAstJSON = flag.Bool("ast-json", false, "print the syntax tree of the script as JSON instead of running it")
+	disasm      = flag.Bool("disasm", false, "print the bytecode the script compiles to instead of running it")
+	program     = flag.String("e", "", "run `code` instead of a script file")
+	backend     = flag.String("backend", "tree", "run scripts with the tree walking interpreter (tree), the closure compiler (closure) or the bytecode VM (vm)")
+	trace       = flag.Bool("trace", false, "print the VM stack and each instruction as it runs, implies -backend vm")
+	timeout     = flag.Duration("timeout", 0, "stop the script if it's still running after `duration`")
+	maxSteps    = flag.Int("steps", 0, "stop the script after `n` loop iterations and function calls")
+	maxDepth    = flag.Int("max-depth", 0, "stop the script with a stack overflow if calls nest more than `n` deep (default 10000)")
+	maxAlloc    = flag.Int("max-alloc", 0, "stop the script once it has allocated roughly `bytes` of strings and instances")
+	sandbox     = flag.String("sandbox", "", "only let the script call natives with the comma separated capabilities in `list`, from pure, io-read, io-write, env and time. Without it every capability is granted, io-write included")
+)
+
+// reporter is sent every error found running a script
+var reporter glox.Reporter = glox.WriterReporter{W: os.Stderr}
+
 func main() {
-	if len(os.Args) == 2 {
-		runFile(os.Args[1])
-	} else if len(os.Args) == 1 {
-		runPrompt()
-	} else {
-		fmt.Println("Usage: glox [script]")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: glox [flags] [script | -] [args...]")
+		fmt.Fprintln(os.Stderr, "Starts the REPL if no script is given, a script of - is read from stdin.")
+		flag.PrintDefaults()
 	}
+	flag.Parse()
+
+	os.Exit(start(flag.Args()))
 }
 
-func runFile(path string) error {
-	b, err := ioutil.ReadFile(path)
+// start works out where the program comes from and runs it, returning the exit code
+func start(args []string) int {
+	sb, err := sandboxFlag()
 	if err != nil {
-		return err
+		fmt.Fprintln(os.Stderr, err)
+		flag.Usage()
+		return exitUsage
 	}
-	//fmt.Println(string(b))
-	run(string(b))
-	return nil
+
+	var source string
+	if flagSet("e") {
+		source = *program
+	} else if len(args) == 0 {
+		if *dumpTokens || *dumpAst || *dumpAstJSON || *disasm {
+			flag.Usage()
+			return exitUsage
+		}
+		runPrompt(sb)
+		return 0
+	} else if args[0] == "-" {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			reporter.Report(err)
+			return exitIOErr
+		}
+		source = string(b)
+		args = args[1:]
+	} else {
+		b, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			reporter.Report(err)
+			return exitNoInput
+		}
+		source = string(b)
+		args = args[1:]
+	}
+
+	if *dumpTokens || *dumpAst || *dumpAstJSON {
+		return dump(source)
+	}
+
+	if *disasm {
+		return disassemble(source)
+	}
+
+	if *trace {
+		*backend = "vm"
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+
+	switch *backend {
+	case "tree":
+		return run(&glox.Interpreter{
+			Globals:       scriptGlobals(args, sb),
+			Reporter:      reporter,
+			Context:       ctx,
+			StepBudget:    *maxSteps,
+			MaxCallDepth:  *maxDepth,
+			MaxAllocation: *maxAlloc,
+		}, source)
+	case "closure":
+		return runClosures(&glox.ClosureInterpreter{
+			Globals:       scriptGlobals(args, sb),
+			Reporter:      reporter,
+			Context:       ctx,
+			StepBudget:    *maxSteps,
+			MaxCallDepth:  *maxDepth,
+			MaxAllocation: *maxAlloc,
+		}, source)
+	case "vm":
+		vm := &glox.VM{
+			Globals:       scriptGlobals(args, sb),
+			Reporter:      reporter,
+			Context:       ctx,
+			StepBudget:    *maxSteps,
+			MaxCallDepth:  *maxDepth,
+			MaxAllocation: *maxAlloc,
+		}
+		if *trace {
+			vm.Trace = os.Stdout
+		}
+		return runVM(vm, source)
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown backend %q\n", *backend)
+	flag.Usage()
+	return exitUsage
 }
 
-func runPrompt() {
-	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Print("> ")
-	for scanner.Scan() {
-		run(scanner.Text())
-		fmt.Print("> ")
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func runPrompt(sb glox.Sandbox) {
+	repl := &Repl{
+		Interpreter: newInterpreter(),
+		Sandbox:     sb,
+	}
+	sb.Define(repl.Interpreter.Globals)
+
+	if !isTerminal(int(os.Stdin.Fd())) {
+		repl.Run(&plainReader{bufio.NewScanner(os.Stdin)})
+		return
+	}
+
+	editor := &LineEditor{
+		In:       os.Stdin,
+		Out:      os.Stdout,
+		Complete: repl.completions,
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		editor.HistoryFile = filepath.Join(home, ".glox_history")
+	}
+	if err := editor.LoadHistory(); err != nil {
+		repl.Interpreter.Report(err)
 	}
+	repl.Run(editor)
 }
 
-func run(script string) {
-	scanner := glox.Scanner{
-		Source: script,
+// newInterpreter returns the Interpreter for the REPL, which shows errors
+// alongside the output rather than on stderr
+func newInterpreter() *glox.Interpreter {
+	return &glox.Interpreter{
+		Globals: make(map[string]glox.Value),
+		Stderr:  os.Stdout,
 	}
+}
 
-	scanner.ScanTokens()
+// sandboxFlag returns the sandbox asked for with -sandbox, which grants
+// every capability if the flag isn't given
+func sandboxFlag() (glox.Sandbox, error) {
+	if !flagSet("sandbox") {
+		return glox.Sandbox{Grant: glox.Capabilities}, nil
+	}
 
-	// for _, token := range scanner.Tokens {
-	// 	fmt.Println(token)
-	// }
+	var sb glox.Sandbox
+	for _, name := range strings.Split(*sandbox, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
 
-	parser := glox.Parser{
-		Tokens: scanner.Tokens,
+		known := false
+		for _, capability := range glox.Capabilities {
+			if glox.Capability(name) == capability {
+				known = true
+			}
+		}
+		if !known {
+			return sb, fmt.Errorf("unknown capability %q", name)
+		}
+		sb.Grant = append(sb.Grant, glox.Capability(name))
 	}
-	stmts := parser.Parse()
+	return sb, nil
+}
 
-	interpreter := &glox.Interpreter{
-		Env: &glox.Environment{
-			Values: make(map[string]interface{}),
+// scriptGlobals returns the natives sb allows and the globals that make the
+// script's command line arguments available: argc, the number of arguments,
+// and arg(n), which returns the nth argument or nil if there aren't that many
+func scriptGlobals(args []string, sb glox.Sandbox) map[string]glox.Value {
+	globals := make(map[string]glox.Value)
+	sb.Define(globals)
+	globals["argc"] = glox.NumberValue(float64(len(args)))
+	globals["arg"] = glox.ObjectValue(&glox.NativeFunction{
+		Name:   "arg",
+		Params: 1,
+		Function: func(intr *glox.Interpreter, values []glox.Value) (glox.Value, error) {
+			n := values[0].AsNumber()
+			if !values[0].IsNumber() || n < 0 || int(n) >= len(args) || float64(int(n)) != n {
+				return glox.NilValue, nil
+			}
+			return glox.StringValue(args[int(n)]), nil
 		},
+	})
+	return globals
+}
+
+// parse scans and parses source, printing any syntax errors
+func parse(source string) ([]glox.Stmt, bool) {
+	scanner := glox.Scanner{
+		Source: source,
+	}
+	tokens := scanner.ScanTokens()
+
+	parser := glox.Parser{
+		Tokens: tokens,
+	}
+	stmts, _ := parser.Parse()
+
+	if errs := append(scanner.Errors, parser.Errors...); len(errs) > 0 {
+		reporter.Report(glox.ParseErrors(errs))
+		return nil, false
+	}
+	return stmts, true
+}
+
+func run(interpreter *glox.Interpreter, source string) int {
+	stmts, ok := parse(source)
+	if !ok {
+		return exitDataErr
 	}
-	//astprinter := AstPrinter{}
 
-	//fmt.Println(astprinter.print(expression))
-	interpreter.Interpret(stmts)
-	//fmt.Println()
+	resolver := glox.Resolver{
+		Interpreter: interpreter,
+	}
+	if err := resolver.Resolve(stmts); err != nil {
+		reporter.Report(err)
+		return exitDataErr
+	}
+
+	if err := interpreter.Interpret(stmts); err != nil {
+		reporter.Report(err)
+		return exitSoftware
+	}
+	return 0
+}
+
+func runClosures(interpreter *glox.ClosureInterpreter, source string) int {
+	stmts, ok := parse(source)
+	if !ok {
+		return exitDataErr
+	}
+
+	resolver := glox.Resolver{}
+	if err := resolver.Resolve(stmts); err != nil {
+		reporter.Report(err)
+		return exitDataErr
+	}
+
+	if err := interpreter.Interpret(stmts); err != nil {
+		reporter.Report(err)
+		return exitSoftware
+	}
+	return 0
+}
+
+func runVM(vm *glox.VM, source string) int {
+	stmts, ok := parse(source)
+	if !ok {
+		return exitDataErr
+	}
+
+	function, err := glox.Compile(stmts)
+	if err != nil {
+		reporter.Report(err)
+		return exitDataErr
+	}
+
+	if err := vm.Interpret(function); err != nil {
+		reporter.Report(err)
+		return exitSoftware
+	}
+	return 0
+}
+
+func disassemble(source string) int {
+	stmts, ok := parse(source)
+	if !ok {
+		return exitDataErr
+	}
+
+	function, err := glox.Compile(stmts)
+	if err != nil {
+		reporter.Report(err)
+		return exitDataErr
+	}
+
+	glox.Disassemble(os.Stdout, function)
+	return 0
+}
+
+// dump prints the tokens or syntax tree of source as asked for by the flags
+func dump(source string) int {
+	if *dumpTokens {
+		scanner := glox.Scanner{
+			Source: source,
+		}
+		for _, token := range scanner.ScanTokens() {
+			fmt.Println(token)
+		}
+		if len(scanner.Errors) > 0 {
+			reporter.Report(glox.ParseErrors(scanner.Errors))
+			return exitDataErr
+		}
+	}
+
+	if !*dumpAst && !*dumpAstJSON {
+		return 0
+	}
+
+	stmts, ok := parse(source)
+	if !ok {
+		return exitDataErr
+	}
+
+	if *dumpAst {
+		printer := AstPrinter{}
+		for _, stmt := range stmts {
+			fmt.Println(printer.printStmt(stmt))
+		}
+	}
+
+	if *dumpAstJSON {
+		b, err := json.MarshalIndent(AstJSON{}.stmts(stmts), "", "  ")
+		if err != nil {
+			reporter.Report(err)
+			return exitSoftware
+		}
+		fmt.Println(string(b))
+	}
+	return 0
 }
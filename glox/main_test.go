@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+
+	"github.com/arowshot/glox"
+)
+
+func TestSandboxFlag(t *testing.T) {
+	sb, err := sandboxFlag()
+	if err != nil || !reflect.DeepEqual(sb.Grant, glox.Capabilities) {
+		t.Errorf("without -sandbox got %v, %v, want every capability", sb.Grant, err)
+	}
+
+	flag.Set("sandbox", "pure, io-read,io-write,env,time")
+	sb, err = sandboxFlag()
+	want := []glox.Capability{glox.CAP_PURE, glox.CAP_IO_READ, glox.CAP_IO_WRITE, glox.CAP_ENV, glox.CAP_TIME}
+	if err != nil || !reflect.DeepEqual(sb.Grant, want) {
+		t.Errorf("got %v, %v, want %v", sb.Grant, err, want)
+	}
+
+	flag.Set("sandbox", "")
+	if sb, err = sandboxFlag(); err != nil || len(sb.Grant) != 0 {
+		t.Errorf("with an empty list got %v, %v, want nothing granted", sb.Grant, err)
+	}
+
+	flag.Set("sandbox", "pure,network")
+	if _, err := sandboxFlag(); err == nil {
+		t.Error("unknown capability network was accepted")
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/arowshot/glox"
+)
+
+const (
+	prompt         = "> "
+	continuePrompt = "... "
+)
+
+// Repl reads Lox code a line at a time and runs it against a single
+// Interpreter, so declarations carry over from one input to the next
+type Repl struct {
+	Interpreter *glox.Interpreter
+	Sandbox     glox.Sandbox // Decides the natives defined, again after a reset
+
+	lastID int // LastID of the parser of the last input, the next carries on from it
+}
+
+// Run reads from input until it runs out. Input that is incomplete, such as
+// an unclosed block or a statement missing its semicolon, is continued on
+// the next line. A blank line forces incomplete input to run anyway
+func (repl *Repl) Run(input lineReader) {
+	var lines []string
+
+	for {
+		linePrompt := prompt
+		if len(lines) > 0 {
+			linePrompt = continuePrompt
+		}
+
+		line, err := input.ReadLine(linePrompt)
+		if err == errInterrupted {
+			lines = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		if len(lines) == 0 && strings.HasPrefix(line, ":") {
+			repl.command(line)
+			continue
+		}
+
+		lines = append(lines, line)
+
+		if !repl.execute(strings.Join(lines, "\n"), line == "") {
+			continue
+		}
+
+		lines = nil
+	}
+}
+
+// execute runs source, returning false without running anything if source
+// looks incomplete and force is not set. Bare expressions have their value
+// printed. Line numbers in errors count from the start of source
+func (repl *Repl) execute(source string, force bool) bool {
+	scanner := glox.Scanner{
+		Source: source,
+	}
+	tokens := scanner.ScanTokens()
+
+	if !force && (unbalanced(tokens) || unterminatedString(scanner.Errors)) {
+		return false
+	}
+
+	if len(scanner.Errors) > 0 {
+		repl.Interpreter.Report(glox.ParseErrors(scanner.Errors))
+		return true
+	}
+
+	exprParser := glox.Parser{
+		Tokens: tokens,
+		LastID: repl.lastID,
+	}
+	if expr, err := exprParser.ParseExpr(); err == nil {
+		repl.lastID = exprParser.LastID
+		if !repl.resolve([]glox.Stmt{glox.Expression{Expression: expr}}) {
+			return true
+		}
+		if err := repl.Interpreter.InterpretExpr(expr); err != nil {
+			repl.Interpreter.Report(err)
+		}
+		return true
+	}
+
+	parser := glox.Parser{
+		Tokens: tokens,
+		LastID: repl.lastID,
+	}
+	stmts, err := parser.Parse()
+	repl.lastID = parser.LastID
+	if err != nil {
+		if !force && errorAtEnd(parser.Errors) {
+			return false
+		}
+		repl.Interpreter.Report(err)
+		return true
+	}
+
+	if !repl.resolve(stmts) {
+		return true
+	}
+	if err := repl.Interpreter.Interpret(stmts); err != nil {
+		repl.Interpreter.Report(err)
+	}
+	return true
+}
+
+// completions returns the keywords and names in scope that start with prefix
+func (repl *Repl) completions(prefix string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(name string) {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	for keyword := range glox.Keywords {
+		add(keyword)
+	}
+	for name := range repl.Interpreter.Globals {
+		add(name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func (repl *Repl) resolve(stmts []glox.Stmt) bool {
+	resolver := glox.Resolver{
+		Interpreter: repl.Interpreter,
+	}
+	if err := resolver.Resolve(stmts); err != nil {
+		repl.Interpreter.Report(err)
+		return false
+	}
+	return true
+}
+
+// unbalanced reports whether tokens has more opening braces or parentheses than closing ones
+func unbalanced(tokens []glox.Token) bool {
+	depth := 0
+	for _, token := range tokens {
+		switch token.TokenType {
+		case glox.LEFT_BRACE, glox.LEFT_PAREN:
+			depth++
+		case glox.RIGHT_BRACE, glox.RIGHT_PAREN:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// unterminatedString reports whether errs include a string still open at
+// the end of the input, which more lines could close
+func unterminatedString(errs []glox.ParseError) bool {
+	for _, err := range errs {
+		if err.Unterminated {
+			return true
+		}
+	}
+	return false
+}
+
+// errorAtEnd reports whether any of errs happened because the input ran out
+func errorAtEnd(errs []glox.ParseError) bool {
+	for _, err := range errs {
+		if err.Token.TokenType == glox.EOF {
+			return true
+		}
+	}
+	return false
+}
+
+// stdout is where the REPL writes, the same place as the Interpreter's print
+func (repl *Repl) stdout() io.Writer {
+	if repl.Interpreter.Stdout == nil {
+		return os.Stdout
+	}
+	return repl.Interpreter.Stdout
+}
+
+// commands are the REPL meta-commands, each is given the rest of the line after its name
+var commands = map[string]func(repl *Repl, arg string){
+	"load":   (*Repl).load,
+	"reset":  (*Repl).reset,
+	"env":    (*Repl).env,
+	"ast":    (*Repl).ast,
+	"tokens": (*Repl).tokens,
+	"time":   (*Repl).time,
+	"help":   (*Repl).help,
+}
+
+func (repl *Repl) command(line string) {
+	name, arg := line[1:], ""
+	if i := strings.IndexAny(name, " \t"); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i:])
+	}
+
+	command, exists := commands[name]
+	if !exists {
+		fmt.Fprintf(repl.stdout(), "unknown command :%s, try :help\n", name)
+		return
+	}
+	command(repl, arg)
+}
+
+// load runs a file in the current session
+func (repl *Repl) load(path string) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		repl.Interpreter.Report(err)
+		return
+	}
+
+	repl.execute(string(b), true)
+}
+
+// reset throws away every global and local binding, leaving only the natives
+func (repl *Repl) reset(string) {
+	repl.Interpreter.Env = nil
+	repl.Interpreter.Globals = make(map[string]glox.Value)
+	repl.Interpreter.Locals = nil
+	repl.Sandbox.Define(repl.Interpreter.Globals)
+}
+
+// env prints every global binding, locals only exist while their code is running
+func (repl *Repl) env(string) {
+	var names []string
+	for name := range repl.Interpreter.Globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(repl.stdout(), "%s = %s\n", name, repl.Interpreter.Globals[name])
+	}
+}
+
+// ast prints the syntax tree of source without running it
+func (repl *Repl) ast(source string) {
+	scanner := glox.Scanner{
+		Source: source,
+	}
+	tokens := scanner.ScanTokens()
+	if len(scanner.Errors) > 0 {
+		repl.Interpreter.Report(glox.ParseErrors(scanner.Errors))
+		return
+	}
+
+	printer := AstPrinter{}
+
+	exprParser := glox.Parser{
+		Tokens: tokens,
+	}
+	if expr, err := exprParser.ParseExpr(); err == nil {
+		fmt.Fprintln(repl.stdout(), printer.print(expr))
+		return
+	}
+
+	parser := glox.Parser{
+		Tokens: tokens,
+	}
+	stmts, err := parser.Parse()
+	if err != nil {
+		repl.Interpreter.Report(err)
+		return
+	}
+	for _, stmt := range stmts {
+		fmt.Fprintln(repl.stdout(), printer.printStmt(stmt))
+	}
+}
+
+// tokens prints the tokens the scanner finds in source
+func (repl *Repl) tokens(source string) {
+	scanner := glox.Scanner{
+		Source: source,
+	}
+	for _, token := range scanner.ScanTokens() {
+		fmt.Fprintln(repl.stdout(), token)
+	}
+	if len(scanner.Errors) > 0 {
+		repl.Interpreter.Report(glox.ParseErrors(scanner.Errors))
+	}
+}
+
+// time runs source in the current session and prints how long it took
+func (repl *Repl) time(source string) {
+	start := time.Now()
+	repl.execute(source, true)
+	fmt.Fprintf(repl.stdout(), "took %v\n", time.Since(start))
+}
+
+func (repl *Repl) help(string) {
+	fmt.Fprintln(repl.stdout(), `:load <file>     run a file in this session
+:reset           forget every variable, function and class
+:env             show all bindings in scope
+:ast <code>      show the syntax tree of code
+:tokens <code>   show the tokens in code
+:time <code>     run code and show how long it took
+:help            show this message`)
+}
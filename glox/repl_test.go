@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/arowshot/glox"
+)
+
+func TestReplCommandsWriteToStdout(t *testing.T) {
+	var stdout bytes.Buffer
+	repl := &Repl{
+		Interpreter: &glox.Interpreter{
+			Globals: make(map[string]glox.Value),
+			Stdout:  &stdout,
+		},
+	}
+
+	repl.execute("var a = 1;", true)
+	for _, command := range []string{":env", ":ast 1 + 2", ":tokens a", ":time print a;", ":nope"} {
+		repl.command(command)
+	}
+
+	for _, want := range []string{"a = 1\n", "(+ 1 2)\n", "IDENTIFIER\ta", "1\ntook ", "unknown command :nope"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output %q doesn't include %q", stdout.String(), want)
+		}
+	}
+}
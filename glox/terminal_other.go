@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import "errors"
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func enableRawMode(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
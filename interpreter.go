@@ -1,150 +1,368 @@
 package glox
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"math"
+	"os"
 )
 
 type Interpreter struct {
-	Env *Environment
+	// Env is the innermost local scope, it's nil at the top level
+	Env     *Environment
+	Globals map[string]Value
+
+	// Stdout is where print writes, Stderr where errors are reported if
+	// there's no Reporter, and Stdin what natives read input from. When nil
+	// they default to the process's own streams
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+
+	// Reporter, if set, is sent the errors passed to Report
+	Reporter Reporter
+
+	// Context, if set, stops the program with its error once it's done,
+	// use context.WithTimeout to limit how long a program runs. StepBudget,
+	// if more than 0, limits how many loop iterations and function calls
+	// each call to Interpret may make before it's stopped with
+	// ErrBudgetExceeded
+	Context    context.Context
+	StepBudget int
+
+	// MaxCallDepth is how deeply calls can nest before the program is
+	// stopped with a StackOverflowError, 0 means a default of 10000.
+	// MaxAllocation, if more than 0, is roughly how many bytes of strings
+	// and instances each call to Interpret may create before it's stopped
+	// with an AllocationError
+	MaxCallDepth  int
+	MaxAllocation int
+
+	budget *budget // Of the program running now
+
+	// Locals holds the slot the Resolver gave each variable, indexed by the
+	// ID of the node using it. Globals have a Depth of globalDepth
+	Locals []Slot
 }
 
-func (intr Interpreter) VisitBinaryExpr(expr Binary) interface{} {
+func (intr *Interpreter) evalBinary(expr Binary) Value {
 	left := intr.eval(expr.Left)
 	right := intr.eval(expr.Right)
 
 	switch expr.Operator.TokenType {
 	case GREATER:
-		l := left.(float64)
-		r := right.(float64)
-		return l > r
+		l, r := checkNumberOperands(expr.Operator, left, right)
+		return BoolValue(l > r)
 	case GREATER_EQUAL:
-		l := left.(float64)
-		r := right.(float64)
-		return l >= r
+		l, r := checkNumberOperands(expr.Operator, left, right)
+		return BoolValue(l >= r)
 	case LESS:
-		l := left.(float64)
-		r := right.(float64)
-		return l < r
+		l, r := checkNumberOperands(expr.Operator, left, right)
+		return BoolValue(l < r)
 	case LESS_EQUAL:
-		l := left.(float64)
-		r := right.(float64)
-		return l <= r
+		l, r := checkNumberOperands(expr.Operator, left, right)
+		return BoolValue(l <= r)
 	case BANG_EQUAL:
-		return !isEqual(left, right)
+		return BoolValue(!left.Equal(right))
 	case EQUAL_EQUAL:
-		return isEqual(left, right)
+		return BoolValue(left.Equal(right))
 	case MINUS:
-		l := left.(float64)
-		r := right.(float64)
-		return l - r
+		l, r := checkNumberOperands(expr.Operator, left, right)
+		return NumberValue(l - r)
 	case STAR:
-		l := left.(float64)
-		r := right.(float64)
-		return l * r
+		l, r := checkNumberOperands(expr.Operator, left, right)
+		return NumberValue(l * r)
 	case STARSTAR:
-		l := left.(float64)
-		r := right.(float64)
-		return math.Pow(l, r)
+		l, r := checkNumberOperands(expr.Operator, left, right)
+		return NumberValue(math.Pow(l, r))
 	case SLASH:
-		l := left.(float64)
-		r := right.(float64)
-		return l / r
+		l, r := checkNumberOperands(expr.Operator, left, right)
+		return NumberValue(l / r)
 	case PLUS:
-		lfloat, lisfloat := left.(float64)
-		rfloat, risfloat := right.(float64)
+		if left.IsNumber() && right.IsNumber() {
+			return NumberValue(left.AsNumber() + right.AsNumber())
+		}
+
+		if left.IsString() && right.IsString() {
+			s := left.AsString() + right.AsString()
+			intr.budget.allocate(expr.Operator, stringSize+len(s))
+			return StringValue(s)
+		}
+
+		panic(RuntimeError{expr.Operator, "operands must be two numbers or two strings"})
+	}
+
+	return NilValue
+}
 
-		lstring, lisstring := left.(string)
-		rstring, risstring := right.(string)
+func (intr *Interpreter) evalCall(expr Call) Value {
+	callee := intr.eval(expr.Callee)
 
-		if lisfloat && risfloat {
-			return lfloat + rfloat
+	var args []Value
+	for _, arg := range expr.Arguments {
+		args = append(args, intr.eval(arg))
+	}
+
+	function, isCallable := callee.AsObject().(LoxCallable)
+	if !isCallable {
+		panic(RuntimeError{expr.Paren, "can only call functions and classes"})
+	}
+
+	if len(args) != function.Arity() {
+		panic(RuntimeError{expr.Paren, fmt.Sprintf("expected %v arguments but got %v", function.Arity(), len(args))})
+	}
+
+	intr.budget.step()
+
+	// Natives are called directly so their errors can be reported where the call is
+	if native, isNative := function.(*NativeFunction); isNative {
+		value, err := native.Function(intr, args)
+		if err != nil {
+			panic(nativeError(expr.Paren, err))
 		}
+		return value
+	}
 
-		if lisstring && risstring {
-			return lstring + rstring
+	if _, isClass := function.(*LoxClass); isClass {
+		intr.budget.allocate(expr.Paren, instanceSize)
+	}
+
+	intr.budget.enter(expr.Paren)
+	defer intr.budget.leave()
+	return function.Call(intr, args)
+}
+
+func (intr *Interpreter) evalGet(expr Get) Value {
+	object := intr.eval(expr.Object)
+
+	if properties, hasProperties := object.AsObject().(PropertyObject); hasProperties {
+		value, err := properties.GetProperty(expr.Name.Lexeme)
+		if err != nil {
+			panic(RuntimeError{expr.Name, err.Error()})
 		}
+		return value
 	}
 
-	return nil
+	instance, isInstance := object.AsObject().(*LoxInstance)
+	if !isInstance {
+		panic(RuntimeError{expr.Name, "only instances have properties"})
+	}
+
+	value, err := instance.get(expr.Name)
+	if err != nil {
+		panic(err)
+	}
+	return value
 }
 
-func (intr Interpreter) VisitGroupingExpr(expr Grouping) interface{} {
+func (intr *Interpreter) evalGrouping(expr Grouping) Value {
 	return intr.eval(expr.Expression)
 }
 
-func (intr Interpreter) VisitLiteralExpr(expr Literal) interface{} {
+func (intr *Interpreter) evalLiteral(expr Literal) Value {
 	return expr.Value
 }
 
-func (intr Interpreter) VisitUnaryExpr(expr Unary) interface{} {
+func (intr *Interpreter) evalLogical(expr Logical) Value {
+	left := intr.eval(expr.Left)
+
+	if expr.Operator.TokenType == OR {
+		if left.IsTruthy() {
+			return left
+		}
+	} else {
+		if !left.IsTruthy() {
+			return left
+		}
+	}
+
+	return intr.eval(expr.Right)
+}
+
+func (intr *Interpreter) evalSet(expr Set) Value {
+	object := intr.eval(expr.Object)
+
+	if properties, hasProperties := object.AsObject().(PropertyObject); hasProperties {
+		value := intr.eval(expr.Value)
+		if err := properties.SetProperty(expr.Name.Lexeme, value); err != nil {
+			panic(RuntimeError{expr.Name, err.Error()})
+		}
+		return value
+	}
+
+	instance, isInstance := object.AsObject().(*LoxInstance)
+	if !isInstance {
+		panic(RuntimeError{expr.Name, "only instances have fields"})
+	}
+
+	value := intr.eval(expr.Value)
+	if _, hasField := instance.Fields[expr.Name.Lexeme]; !hasField {
+		intr.budget.allocate(expr.Name, fieldSize)
+	}
+	instance.set(expr.Name, value)
+	return value
+}
+
+func (intr *Interpreter) evalSuper(expr Super) Value {
+	slot := intr.Locals[expr.ID]
+	superclass := intr.Env.getAt(slot).AsObject().(*LoxClass)
+	object := intr.Env.getAt(Slot{Depth: slot.Depth - 1}).AsObject().(*LoxInstance)
+
+	method := superclass.findMethod(expr.Method.Lexeme)
+	if method == nil {
+		panic(RuntimeError{expr.Method, fmt.Sprintf("undefined property '%s'", expr.Method.Lexeme)})
+	}
+
+	return ObjectValue(method.Bind(object))
+}
+
+func (intr *Interpreter) evalThis(expr This) Value {
+	return intr.lookUpVariable(expr.Keyword, expr.ID)
+}
+
+func (intr *Interpreter) evalUnary(expr Unary) Value {
 	right := intr.eval(expr.Right)
 
 	switch expr.Operator.TokenType {
 	case BANG:
-		return !isTruthy(right)
+		return BoolValue(!right.IsTruthy())
 	case MINUS:
-		switch i := right.(type) {
-		case float64:
-			return -float64(i)
-		default:
-			fmt.Println("- expected number")
-		}
+		return NumberValue(-checkNumberOperand(expr.Operator, right))
 	}
 
-	return nil
+	return NilValue
 }
 
-func (intr Interpreter) VisitVariableExpr(expr Variable) interface{} {
-	return intr.Env.get(expr.Name)
+func (intr *Interpreter) evalVariable(expr Variable) Value {
+	return intr.lookUpVariable(expr.Name, expr.ID)
 }
 
-func (intr Interpreter) VisitAssignExpr(expr Assign) interface{} {
+func (intr *Interpreter) evalAssign(expr Assign) Value {
 	value := intr.eval(expr.Value)
 
-	intr.Env.assign(expr.Name, value)
+	if slot := intr.local(expr.ID); slot.Depth != globalDepth {
+		intr.Env.assignAt(slot, value)
+	} else {
+		intr.assignGlobal(expr.Name, value)
+	}
 	return value
 }
 
+func (intr *Interpreter) lookUpVariable(name Token, id int) Value {
+	if slot := intr.local(id); slot.Depth != globalDepth {
+		return intr.Env.getAt(slot)
+	}
+
+	return intr.getGlobal(name)
+}
+
+// local returns the slot of the variable used by the node with the given
+// ID, nodes the Resolver hasn't seen are global
+func (intr *Interpreter) local(id int) Slot {
+	if id >= len(intr.Locals) {
+		return Slot{Depth: globalDepth}
+	}
+	return intr.Locals[id]
+}
+
+func (intr *Interpreter) VisitClassStmt(stmt Class) interface{} {
+	var superclass *LoxClass
+	if stmt.Superclass != nil {
+		class, isClass := intr.eval(*stmt.Superclass).AsObject().(*LoxClass)
+		if !isClass {
+			panic(RuntimeError{stmt.Superclass.Name, "superclass must be a class"})
+		}
+		superclass = class
+	}
+
+	closure := intr.Env
+	if superclass != nil {
+		closure = &Environment{Enclosing: intr.Env}
+		closure.define(ObjectValue(superclass))
+	}
+
+	methods := make(map[string]*LoxFunction)
+	for _, method := range stmt.Methods {
+		methods[method.Name.Lexeme] = &LoxFunction{
+			Declaration:   method,
+			Closure:       closure,
+			IsInitializer: method.Name.Lexeme == "init",
+		}
+	}
+
+	intr.define(stmt.Name.Lexeme, ObjectValue(&LoxClass{
+		Name:       stmt.Name.Lexeme,
+		Superclass: superclass,
+		Methods:    methods,
+	}))
+	return nil
+}
+
 func (intr *Interpreter) VisitExpressionStmt(stmt Expression) interface{} {
 	intr.eval(stmt.Expression)
 	return nil
 }
 
-func (intr *Interpreter) VisitPrintStmt(stmt Print) interface{} {
-	val := intr.eval(stmt.Expression)
-	switch v := val.(type) {
-	case string:
-		fmt.Println(v)
-	default:
-		fmt.Println(v)
+func (intr *Interpreter) VisitFunctionStmt(stmt Function) interface{} {
+	function := &LoxFunction{
+		Declaration: stmt,
+		Closure:     intr.Env,
+	}
+	intr.define(stmt.Name.Lexeme, ObjectValue(function))
+	return nil
+}
+
+func (intr *Interpreter) VisitIfStmt(stmt If) interface{} {
+	if intr.eval(stmt.Condition).IsTruthy() {
+		return intr.execute(stmt.ThenBranch)
+	} else if stmt.ElseBranch != nil {
+		return intr.execute(stmt.ElseBranch)
 	}
 	return nil
 }
 
+func (intr *Interpreter) VisitPrintStmt(stmt Print) interface{} {
+	fmt.Fprintln(intr.stdout(), intr.eval(stmt.Expression))
+	return nil
+}
+
+func (intr *Interpreter) VisitReturnStmt(stmt Return) interface{} {
+	var value Value
+	if stmt.Value != nil {
+		value = intr.eval(stmt.Value)
+	}
+
+	return returnValue{value}
+}
+
 func (intr *Interpreter) VisitVarStmt(stmt Var) interface{} {
-	var value interface{}
+	var value Value
 	if stmt.Initializer != nil {
 		value = intr.eval(stmt.Initializer)
 	}
 
-	intr.Env.define(stmt.Name.Lexeme, value)
+	intr.define(stmt.Name.Lexeme, value)
 	return nil
 }
 
 func (intr *Interpreter) VisitBlockStmt(stmt Block) interface{} {
-	intr.executeBlock(stmt.Statements, &Environment{Enclosing: intr.Env})
-	return nil
+	return intr.executeBlock(stmt.Statements, &Environment{Enclosing: intr.Env})
 }
 
 func (intr *Interpreter) VisitWhileStmt(stmt While) interface{} {
-	for isTruthy(intr.eval(stmt.Condition)) {
-		intr.execute(stmt.Body)
+	for intr.eval(stmt.Condition).IsTruthy() {
+		intr.budget.step()
+		if ret := intr.execute(stmt.Body); ret != nil {
+			return ret
+		}
 	}
 	return nil
 }
 
-func (intr *Interpreter) executeBlock(stmts []Stmt, env *Environment) {
+// executeBlock runs the statements in env, stopping early and passing on the
+// result if a statement returns from the enclosing function
+func (intr *Interpreter) executeBlock(stmts []Stmt, env *Environment) interface{} {
 	prev := intr.Env
 	defer func() {
 		intr.Env = prev
@@ -153,58 +371,154 @@ func (intr *Interpreter) executeBlock(stmts []Stmt, env *Environment) {
 	intr.Env = env
 
 	for _, stmt := range stmts {
-		intr.execute(stmt)
+		if ret := intr.execute(stmt); ret != nil {
+			return ret
+		}
 	}
+	return nil
 }
 
-func (intr *Interpreter) eval(expr Expr) interface{} {
-	v := expr.Accept(intr.visitor())
-	//fmt.Println(v)
-	return v
+// eval switches on the type of expr itself rather than going through
+// ExprVisitor, whose interface{} results would box every Value
+func (intr *Interpreter) eval(expr Expr) Value {
+	switch expr := expr.(type) {
+	case Assign:
+		return intr.evalAssign(expr)
+	case Binary:
+		return intr.evalBinary(expr)
+	case Call:
+		return intr.evalCall(expr)
+	case Get:
+		return intr.evalGet(expr)
+	case Grouping:
+		return intr.evalGrouping(expr)
+	case Literal:
+		return intr.evalLiteral(expr)
+	case Logical:
+		return intr.evalLogical(expr)
+	case Set:
+		return intr.evalSet(expr)
+	case Super:
+		return intr.evalSuper(expr)
+	case This:
+		return intr.evalThis(expr)
+	case Unary:
+		return intr.evalUnary(expr)
+	case Variable:
+		return intr.evalVariable(expr)
+	}
+
+	panic(fmt.Sprintf("unknown expression type %T", expr))
 }
 
-func (intr Interpreter) execute(stmt Stmt) {
-	var v StmtVisitor = &intr
-	stmt.Accept(&v)
+func (intr *Interpreter) execute(stmt Stmt) interface{} {
+	var v StmtVisitor = intr
+	return stmt.Accept(&v)
 }
 
-func (intr *Interpreter) Interpret(stmts []Stmt) {
+// Interpret executes stmts, stopping at and returning the first runtime error
+func (intr *Interpreter) Interpret(stmts []Stmt) (err error) {
+	intr.init()
+	defer recoverError(&err)
+	defer intr.begin()()
+
 	for _, stmt := range stmts {
 		intr.execute(stmt)
 	}
+	return nil
 }
 
-func (intr *Interpreter) InterpretExpr(expr Expr) {
+// InterpretExpr evaluates expr and prints the result
+func (intr *Interpreter) InterpretExpr(expr Expr) (err error) {
+	intr.init()
+	defer recoverError(&err)
+	defer intr.begin()()
+
 	val := intr.eval(expr)
 
-	fmt.Println(stringify(val))
+	fmt.Fprintln(intr.stdout(), val)
+	return nil
+}
+
+// init sets up the globals if the Interpreter was created without them
+func (intr *Interpreter) init() {
+	if intr.Globals == nil {
+		intr.Globals = make(map[string]Value)
+	}
+}
+
+// begin gives the program about to run a new budget, unless Go code it
+// called is calling back into Lox and it already has one. It returns the
+// function to call when the program finishes
+func (intr *Interpreter) begin() func() {
+	if intr.budget != nil {
+		return func() {}
+	}
+
+	intr.budget = newBudget(intr.Context, intr.StepBudget, intr.MaxCallDepth, intr.MaxAllocation)
+	return func() {
+		intr.budget = nil
+	}
+}
+
+// Report sends err to the Reporter, or writes it to Stderr if there isn't one
+func (intr *Interpreter) Report(err error) {
+	if intr.Reporter != nil {
+		intr.Reporter.Report(err)
+		return
+	}
+
+	stderr := intr.Stderr
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+	WriterReporter{stderr}.Report(err)
 }
 
-func (intr *Interpreter) visitor() *ExprVisitor {
-	var v ExprVisitor = *intr
-	return &v
+func (intr *Interpreter) stdout() io.Writer {
+	if intr.Stdout == nil {
+		return os.Stdout
+	}
+	return intr.Stdout
 }
 
-func isTruthy(val interface{}) bool {
-	switch i := val.(type) {
-	case float64:
-		return i != 0
-	case string:
-		return i != ""
-	case bool:
-		return bool(i)
-	case nil:
-		return false
+func (intr *Interpreter) stdin() io.Reader {
+	if intr.Stdin == nil {
+		return os.Stdin
 	}
-	return true
+	return intr.Stdin
 }
 
-func isEqual(left, right interface{}) bool {
-	return left == right
+// resolve is called by the Resolver for each local variable it finds
+func (intr *Interpreter) resolve(id int, slot Slot) {
+	for len(intr.Locals) <= id {
+		intr.Locals = append(intr.Locals, Slot{Depth: globalDepth})
+	}
+	intr.Locals[id] = slot
 }
 
-func stringify(val interface{}) string {
-	return fmt.Sprint(val)
+// resolveGlobal forgets any earlier resolution of the node with the given
+// ID, so an ID shared with an earlier tree falls back to the globals
+func (intr *Interpreter) resolveGlobal(id int) {
+	if id < len(intr.Locals) {
+		intr.Locals[id] = Slot{Depth: globalDepth}
+	}
+}
+
+func checkNumberOperand(operator Token, operand Value) float64 {
+	if operand.IsNumber() {
+		return operand.AsNumber()
+	}
+
+	panic(RuntimeError{operator, "operand must be a number"})
+}
+
+func checkNumberOperands(operator Token, left, right Value) (float64, float64) {
+	if left.IsNumber() && right.IsNumber() {
+		return left.AsNumber(), right.AsNumber()
+	}
+
+	panic(RuntimeError{operator, "operands must be numbers"})
 }
 
 // func (intr *Interpreter) print(expr glox.Expr) string {
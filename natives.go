@@ -0,0 +1,118 @@
+package glox
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// native is a built in function and the capability a program needs to call it
+type native struct {
+	capability Capability
+	arity      int
+	fn         func(intr *Interpreter, args []Value) (Value, error)
+}
+
+// natives are the built in functions a Sandbox hands out
+var natives = map[string]native{
+	"str": {CAP_PURE, 1, func(intr *Interpreter, args []Value) (Value, error) {
+		return StringValue(args[0].String()), nil
+	}},
+	"num": {CAP_PURE, 1, func(intr *Interpreter, args []Value) (Value, error) {
+		if args[0].IsNumber() {
+			return args[0], nil
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(args[0].AsString()), 64)
+		if !args[0].IsString() || err != nil {
+			return NilValue, nil
+		}
+		return NumberValue(n), nil
+	}},
+	"len": {CAP_PURE, 1, func(intr *Interpreter, args []Value) (Value, error) {
+		if !args[0].IsString() {
+			return NilValue, errors.New("len expects a string")
+		}
+		return NumberValue(float64(utf8.RuneCountInString(args[0].AsString()))), nil
+	}},
+	"floor": {CAP_PURE, 1, func(intr *Interpreter, args []Value) (Value, error) {
+		if !args[0].IsNumber() {
+			return NilValue, errors.New("floor expects a number")
+		}
+		return NumberValue(math.Floor(args[0].AsNumber())), nil
+	}},
+	"sqrt": {CAP_PURE, 1, func(intr *Interpreter, args []Value) (Value, error) {
+		if !args[0].IsNumber() {
+			return NilValue, errors.New("sqrt expects a number")
+		}
+		return NumberValue(math.Sqrt(args[0].AsNumber())), nil
+	}},
+
+	"readLine": {CAP_IO_READ, 0, func(intr *Interpreter, args []Value) (Value, error) {
+		return readLine(intr.stdin())
+	}},
+	"readFile": {CAP_IO_READ, 1, func(intr *Interpreter, args []Value) (Value, error) {
+		if !args[0].IsString() {
+			return NilValue, errors.New("readFile expects a path")
+		}
+		b, err := ioutil.ReadFile(args[0].AsString())
+		if err != nil {
+			return NilValue, err
+		}
+		return StringValue(string(b)), nil
+	}},
+
+	"writeFile": {CAP_IO_WRITE, 2, func(intr *Interpreter, args []Value) (Value, error) {
+		if !args[0].IsString() || !args[1].IsString() {
+			return NilValue, errors.New("writeFile expects a path and a string")
+		}
+		return NilValue, ioutil.WriteFile(args[0].AsString(), []byte(args[1].AsString()), 0666)
+	}},
+
+	"getenv": {CAP_ENV, 1, func(intr *Interpreter, args []Value) (Value, error) {
+		if !args[0].IsString() {
+			return NilValue, errors.New("getenv expects a name")
+		}
+		value, set := os.LookupEnv(args[0].AsString())
+		if !set {
+			return NilValue, nil
+		}
+		return StringValue(value), nil
+	}},
+
+	"clock": {CAP_TIME, 0, func(intr *Interpreter, args []Value) (Value, error) {
+		return NumberValue(float64(time.Now().UnixNano()) / float64(time.Second)), nil
+	}},
+}
+
+// readLine reads a line from r without its line ending, or returns nil at
+// the end of the input. It reads a byte at a time so it never takes more
+// from r than the line
+func readLine(r io.Reader) (Value, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF {
+			if len(line) == 0 {
+				return NilValue, nil
+			}
+			break
+		}
+		if err != nil {
+			return NilValue, err
+		}
+	}
+	return StringValue(strings.TrimSuffix(string(line), "\r")), nil
+}
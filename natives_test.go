@@ -0,0 +1,64 @@
+package glox
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestNativesReadStdin(t *testing.T) {
+	stmts := parse(t, `
+print readLine();
+print readLine();
+print readLine();
+`)
+	want := "first\nsecond\nnil\n"
+
+	run := map[string]func(globals map[string]Value, stdin, stdout *bytes.Buffer) error{
+		"tree": func(globals map[string]Value, stdin, stdout *bytes.Buffer) error {
+			return (&Interpreter{Globals: globals, Stdin: stdin, Stdout: stdout}).Interpret(stmts)
+		},
+		"closure": func(globals map[string]Value, stdin, stdout *bytes.Buffer) error {
+			return (&ClosureInterpreter{Globals: globals, Stdin: stdin, Stdout: stdout}).Interpret(stmts)
+		},
+		"vm": func(globals map[string]Value, stdin, stdout *bytes.Buffer) error {
+			function, err := Compile(stmts)
+			if err != nil {
+				return err
+			}
+			return (&VM{Globals: globals, Stdin: stdin, Stdout: stdout}).Interpret(function)
+		},
+	}
+
+	for name, run := range run {
+		t.Run(name, func(t *testing.T) {
+			globals := make(map[string]Value)
+			Sandbox{Grant: []Capability{CAP_IO_READ}}.Define(globals)
+
+			stdin := bytes.NewBufferString("first\nsecond\n")
+			var stdout bytes.Buffer
+			if err := run(globals, stdin, &stdout); err != nil {
+				t.Fatal(err)
+			}
+			if got := stdout.String(); got != want {
+				t.Errorf("printed %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	reporters := map[string]func(stderr *bytes.Buffer) func(error){
+		"tree":    func(stderr *bytes.Buffer) func(error) { return (&Interpreter{Stderr: stderr}).Report },
+		"closure": func(stderr *bytes.Buffer) func(error) { return (&ClosureInterpreter{Stderr: stderr}).Report },
+		"vm":      func(stderr *bytes.Buffer) func(error) { return (&VM{Stderr: stderr}).Report },
+	}
+
+	for name, reporter := range reporters {
+		var stderr bytes.Buffer
+		reporter(&stderr)(RuntimeError{Message: "oops"})
+		if got := strings.TrimSpace(stderr.String()); got != "runtime error: oops" {
+			t.Errorf("%s reported %q", name, got)
+		}
+	}
+}
@@ -3,25 +3,79 @@ package glox
 import "fmt"
 
 type Parser struct {
-	Tokens  []Token
+	Tokens []Token
+	Errors []ParseError
+
+	// LastID is the ID of the last node given one, the next is numbered on
+	// from it. Variables, assignments, this and super get IDs to be resolved
+	// by, and declarations to be told apart by. Trees run by the same
+	// Interpreter mustn't share IDs, so carry it on from parser to parser
+	LastID int
+
 	current int
 }
 
-func (parser *Parser) ParseExpr() Expr {
-	return parser.readExpression()
+// ParseExpr parses a single expression that must make up the whole token list
+func (parser *Parser) ParseExpr() (expr Expr, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isParseErr := r.(ParseError); !isParseErr {
+				panic(r)
+			}
+			expr = nil
+			err = ParseErrors(parser.Errors)
+		}
+	}()
+
+	expr = parser.readExpression()
+	if !parser.atEnd() {
+		parser.error(parser.peek(), "expected end of expression")
+	}
+	if len(parser.Errors) > 0 {
+		return nil, ParseErrors(parser.Errors)
+	}
+	return expr, nil
 }
 
-func (parser *Parser) Parse() []Stmt {
+// Parse parses every statement in the token list. Parsing carries on after
+// a syntax error so that all errors are returned together as ParseErrors
+func (parser *Parser) Parse() ([]Stmt, error) {
 	var stmts []Stmt
 
 	for !parser.atEnd() {
-		stmts = append(stmts, parser.readDeclaration())
+		if stmt := parser.readDeclaration(); stmt != nil {
+			stmts = append(stmts, stmt)
+		}
 	}
 
-	return stmts
+	if len(parser.Errors) > 0 {
+		return stmts, ParseErrors(parser.Errors)
+	}
+	return stmts, nil
 }
 
-func (parser *Parser) readDeclaration() Stmt {
+// readDeclaration reads a declaration or statement. If there is a syntax
+// error in it the parser skips to the start of the next statement and nil
+// is returned
+func (parser *Parser) readDeclaration() (stmt Stmt) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isParseErr := r.(ParseError); !isParseErr {
+				panic(r)
+			}
+			parser.synchronize()
+			stmt = nil
+		}
+	}()
+
+	if parser.match(CLASS) {
+		return parser.readClassDeclaration()
+	}
+
+	if parser.match(FUN) {
+		return parser.readFunction("function")
+	}
+
 	if parser.match(VAR) {
 		return parser.readVarDeclaration()
 	}
@@ -29,8 +83,64 @@ func (parser *Parser) readDeclaration() Stmt {
 	return parser.readStatement()
 }
 
+func (parser *Parser) readClassDeclaration() Stmt {
+	name := parser.consume(IDENTIFIER, "expected class name")
+
+	var superclass *Variable
+	if parser.match(LESS) {
+		superName := parser.consume(IDENTIFIER, "expected superclass name")
+		if superName.Lexeme == name.Lexeme {
+			parser.error(superName, "a class can't inherit from itself")
+		}
+		superclass = &Variable{superName, parser.nextID()}
+	}
+
+	parser.consume(LEFT_BRACE, "expected '{' before class body")
+
+	var methods []Function
+	for !parser.check(RIGHT_BRACE) && !parser.atEnd() {
+		methods = append(methods, parser.readFunction("method"))
+	}
+
+	parser.consume(RIGHT_BRACE, "expected '}' after class body")
+
+	return Class{name, superclass, methods, parser.nextID()}
+}
+
+// readFunction reads a named function declaration, kind is used in error messages
+func (parser *Parser) readFunction(kind string) Function {
+	name := parser.consume(IDENTIFIER, fmt.Sprintf("expected %s name", kind))
+
+	parser.consume(LEFT_PAREN, fmt.Sprintf("expected '(' after %s name", kind))
+	var params []Token
+	if !parser.check(RIGHT_PAREN) {
+		for {
+			if len(params) >= 255 {
+				parser.error(parser.peek(), "can't have more than 255 parameters")
+			}
+
+			param := parser.consume(IDENTIFIER, "expected parameter name")
+			params = append(params, param)
+
+			if !parser.match(COMMA) {
+				break
+			}
+		}
+	}
+	parser.consume(RIGHT_PAREN, "expected ')' after parameters")
+
+	// The parameters are numbered on from the function's own ID
+	id := parser.nextID()
+	parser.LastID += len(params)
+
+	parser.consume(LEFT_BRACE, fmt.Sprintf("expected '{' before %s body", kind))
+	body := parser.readBlock()
+
+	return Function{name, params, body, id}
+}
+
 func (parser *Parser) readVarDeclaration() Stmt {
-	name, _ := parser.consume(IDENTIFIER, "Expected variable name.")
+	name := parser.consume(IDENTIFIER, "Expected variable name.")
 
 	var expr Expr
 	if parser.match(EQUAL) {
@@ -39,14 +149,26 @@ func (parser *Parser) readVarDeclaration() Stmt {
 
 	parser.consume(SEMICOLON, "Expected ';' after variable declaration")
 
-	return Var{name, expr}
+	return Var{name, expr, parser.nextID()}
 }
 
 func (parser *Parser) readStatement() Stmt {
+	if parser.match(FOR) {
+		return parser.readForStatement()
+	}
+
+	if parser.match(IF) {
+		return parser.readIfStatement()
+	}
+
 	if parser.match(PRINT) {
 		return parser.readPrintStatement()
 	}
 
+	if parser.match(RETURN) {
+		return parser.readReturnStatement()
+	}
+
 	if parser.match(WHILE) {
 		return parser.readWhileStatement()
 	}
@@ -58,20 +180,82 @@ func (parser *Parser) readStatement() Stmt {
 	return parser.readExpressionStatement()
 }
 
+// readForStatement desugars a for loop into a while loop wrapped in blocks
+func (parser *Parser) readForStatement() Stmt {
+	keyword := parser.previous()
+	parser.consume(LEFT_PAREN, "expected '(' after for")
+
+	var initializer Stmt
+	if parser.match(SEMICOLON) {
+		initializer = nil
+	} else if parser.match(VAR) {
+		initializer = parser.readVarDeclaration()
+	} else {
+		initializer = parser.readExpressionStatement()
+	}
+
+	var condition Expr
+	if !parser.check(SEMICOLON) {
+		condition = parser.readExpression()
+	}
+	parser.consume(SEMICOLON, "expected ';' after loop condition")
+
+	var increment Expr
+	if !parser.check(RIGHT_PAREN) {
+		increment = parser.readExpression()
+	}
+	parser.consume(RIGHT_PAREN, "expected ')' after for clauses")
+
+	body := parser.readStatement()
+
+	if increment != nil {
+		body = Block{[]Stmt{body, Expression{increment}}}
+	}
+
+	if condition == nil {
+		condition = Literal{BoolValue(true), keyword}
+	}
+	body = While{keyword, condition, body}
+
+	if initializer != nil {
+		body = Block{[]Stmt{initializer, body}}
+	}
+
+	return body
+}
+
+func (parser *Parser) readIfStatement() Stmt {
+	keyword := parser.previous()
+	parser.consume(LEFT_PAREN, "expected '(' after if")
+	condition := parser.readExpression()
+	parser.consume(RIGHT_PAREN, "expected ')' after if condition")
+
+	thenBranch := parser.readStatement()
+	var elseBranch Stmt
+	if parser.match(ELSE) {
+		elseBranch = parser.readStatement()
+	}
+
+	return If{keyword, condition, thenBranch, elseBranch}
+}
+
 func (parser *Parser) readWhileStatement() Stmt {
+	keyword := parser.previous()
 	parser.consume(LEFT_PAREN, "expected '(' after while")
 	condition := parser.readExpression()
 	parser.consume(RIGHT_PAREN, "expected ')' after condition")
 	body := parser.readStatement()
 
-	return While{condition, body}
+	return While{keyword, condition, body}
 }
 
 func (parser *Parser) readBlock() []Stmt {
 	var stmts []Stmt
 
 	for !parser.check(RIGHT_BRACE) && !parser.atEnd() {
-		stmts = append(stmts, parser.readDeclaration())
+		if stmt := parser.readDeclaration(); stmt != nil {
+			stmts = append(stmts, stmt)
+		}
 	}
 
 	parser.consume(RIGHT_BRACE, "expected '}' after block")
@@ -79,15 +263,28 @@ func (parser *Parser) readBlock() []Stmt {
 	return stmts
 }
 
-
 func (parser *Parser) readPrintStatement() Stmt {
+	keyword := parser.previous()
 	value := parser.readExpression()
 	parser.consume(SEMICOLON, "Expected ';' after value.")
 	return Print{
+		Keyword:    keyword,
 		Expression: value,
 	}
 }
 
+func (parser *Parser) readReturnStatement() Stmt {
+	keyword := parser.previous()
+
+	var value Expr
+	if !parser.check(SEMICOLON) {
+		value = parser.readExpression()
+	}
+
+	parser.consume(SEMICOLON, "Expected ';' after return value.")
+	return Return{keyword, value}
+}
+
 func (parser *Parser) readExpressionStatement() Stmt {
 	value := parser.readExpression()
 	parser.consume(SEMICOLON, "Expected ';' after expression.")
@@ -101,16 +298,46 @@ func (parser *Parser) readExpression() Expr {
 }
 
 func (parser *Parser) readAssignment() Expr {
-	expr := parser.readEquality()
+	expr := parser.readOr()
 
 	if parser.match(EQUAL) {
-		//equals := parser.previous()
+		equals := parser.previous()
 		value := parser.readAssignment()
 
 		if v, isVar := expr.(Variable); isVar {
 			name := v.Name
-			return Assign{name, value}
+			return Assign{name, value, parser.nextID()}
+		}
+
+		if get, isGet := expr.(Get); isGet {
+			return Set{get.Object, get.Name, value}
 		}
+
+		parser.error(equals, "invalid assignment target")
+	}
+
+	return expr
+}
+
+func (parser *Parser) readOr() Expr {
+	expr := parser.readAnd()
+
+	for parser.match(OR) {
+		operator := parser.previous()
+		right := parser.readAnd()
+		expr = Logical{expr, operator, right}
+	}
+
+	return expr
+}
+
+func (parser *Parser) readAnd() Expr {
+	expr := parser.readEquality()
+
+	for parser.match(AND) {
+		operator := parser.previous()
+		right := parser.readEquality()
+		expr = Logical{expr, operator, right}
 	}
 
 	return expr
@@ -183,26 +410,78 @@ func (parser *Parser) readUnary() Expr {
 		return Unary{operator, right}
 	}
 
-	return parser.readPrimary()
+	return parser.readCall()
+}
+
+func (parser *Parser) readCall() Expr {
+	expr := parser.readPrimary()
+
+	for {
+		if parser.match(LEFT_PAREN) {
+			expr = parser.finishCall(expr)
+		} else if parser.match(DOT) {
+			name := parser.consume(IDENTIFIER, "expected property name after '.'")
+			expr = Get{expr, name}
+		} else {
+			break
+		}
+	}
+
+	return expr
+}
+
+func (parser *Parser) finishCall(callee Expr) Expr {
+	var args []Expr
+	if !parser.check(RIGHT_PAREN) {
+		for {
+			if len(args) >= 255 {
+				parser.error(parser.peek(), "can't have more than 255 arguments")
+			}
+
+			args = append(args, parser.readExpression())
+
+			if !parser.match(COMMA) {
+				break
+			}
+		}
+	}
+
+	paren := parser.consume(RIGHT_PAREN, "expected ')' after arguments")
+
+	return Call{callee, paren, args}
 }
 
 func (parser *Parser) readPrimary() Expr {
 	if parser.match(FALSE) {
-		return Literal{false}
+		return Literal{BoolValue(false), parser.previous()}
 	}
 	if parser.match(TRUE) {
-		return Literal{true}
+		return Literal{BoolValue(true), parser.previous()}
 	}
 	if parser.match(NIL) {
-		return Literal{nil}
+		return Literal{NilValue, parser.previous()}
 	}
 
-	if parser.match(NUMBER, STRING) {
-		return Literal{parser.previous().Literal}
+	if parser.match(NUMBER) {
+		return Literal{NumberValue(parser.previous().Literal.(float64)), parser.previous()}
+	}
+	if parser.match(STRING) {
+		return Literal{StringValue(parser.previous().Literal.(string)), parser.previous()}
+	}
+
+	if parser.match(SUPER) {
+		keyword := parser.previous()
+		parser.consume(DOT, "expected '.' after 'super'")
+		method := parser.consume(IDENTIFIER, "expected superclass method name")
+		return Super{keyword, method, parser.nextID()}
+	}
+
+	if parser.match(THIS) {
+		return This{parser.previous(), parser.nextID()}
 	}
 
 	if parser.match(IDENTIFIER) {
-		return Variable{parser.previous()}
+		return Variable{parser.previous(), parser.nextID()}
 	}
 
 	if parser.match(LEFT_PAREN) {
@@ -211,18 +490,50 @@ func (parser *Parser) readPrimary() Expr {
 		return Grouping{expr}
 	}
 
-	return nil
+	panic(parser.error(parser.peek(), "expected expression"))
 }
 
-func (parser *Parser) consume(tokenType int, message string) (Token, error) {
+// consume advances past the next token if it is of tokenType, otherwise a
+// ParseError is raised to unwind to the enclosing declaration
+func (parser *Parser) consume(tokenType int, message string) Token {
 	if parser.check(tokenType) {
-		return parser.advance(), nil
+		return parser.advance()
 	}
 
-	err := fmt.Errorf("error on line %v at\"%s\": %s", parser.peek().Line, parser.peek().Lexeme, message)
-	fmt.Println(err)
+	panic(parser.error(parser.peek(), message))
+}
+
+// error records a syntax error at token and returns it, it's up to the
+// caller to decide whether the parser can keep going
+func (parser *Parser) error(token Token, message string) ParseError {
+	err := ParseError{
+		Token:   token,
+		Line:    token.Line,
+		Column:  token.Column,
+		Message: message,
+	}
+	parser.Errors = append(parser.Errors, err)
 
-	return Token{}, err
+	return err
+}
+
+// synchronize discards tokens until it reaches what looks like the start of
+// the next statement
+func (parser *Parser) synchronize() {
+	parser.advance()
+
+	for !parser.atEnd() {
+		if parser.previous().TokenType == SEMICOLON {
+			return
+		}
+
+		switch parser.peek().TokenType {
+		case CLASS, FUN, VAR, FOR, IF, WHILE, PRINT, RETURN:
+			return
+		}
+
+		parser.advance()
+	}
 }
 
 func (parser *Parser) match(tokenTypes ...int) bool {
@@ -261,3 +572,9 @@ func (parser *Parser) peek() Token {
 func (parser *Parser) atEnd() bool {
 	return parser.peek().TokenType == EOF
 }
+
+// nextID returns a new node ID
+func (parser *Parser) nextID() int {
+	parser.LastID++
+	return parser.LastID
+}
@@ -0,0 +1,319 @@
+package glox
+
+const (
+	functionNone = iota
+	functionFunction
+	functionInitializer
+	functionMethod
+)
+
+const (
+	classNone = iota
+	classClass
+	classSubclass
+)
+
+// scopeVar is a variable declared in one of the Resolver's scopes
+type scopeVar struct {
+	slot    int
+	defined bool
+}
+
+// Resolver is a static pass over the syntax tree that works out how many
+// scopes away each local variable is declared and which slot it has there,
+// so the Interpreter can go straight to it
+type Resolver struct {
+	Interpreter *Interpreter
+
+	scopes          []map[string]scopeVar
+	currentFunction int
+	currentClass    int
+	errors          []ParseError
+}
+
+// Resolve resolves every variable used in stmts, returning any static errors found as ParseErrors
+func (resolver *Resolver) Resolve(stmts []Stmt) error {
+	resolver.errors = nil
+	resolver.resolveStmts(stmts)
+
+	if len(resolver.errors) > 0 {
+		return ParseErrors(resolver.errors)
+	}
+	return nil
+}
+
+func (resolver *Resolver) VisitBlockStmt(stmt Block) interface{} {
+	resolver.beginScope()
+	resolver.resolveStmts(stmt.Statements)
+	resolver.endScope()
+	return nil
+}
+
+func (resolver *Resolver) VisitClassStmt(stmt Class) interface{} {
+	enclosingClass := resolver.currentClass
+	resolver.currentClass = classClass
+
+	resolver.declare(stmt.Name)
+	resolver.define(stmt.Name)
+
+	if stmt.Superclass != nil {
+		resolver.currentClass = classSubclass
+		resolver.resolveExpr(*stmt.Superclass)
+
+		resolver.beginScope()
+		resolver.scopes[len(resolver.scopes)-1]["super"] = scopeVar{defined: true}
+	}
+
+	resolver.beginScope()
+	resolver.scopes[len(resolver.scopes)-1]["this"] = scopeVar{defined: true}
+
+	for _, method := range stmt.Methods {
+		declaration := functionMethod
+		if method.Name.Lexeme == "init" {
+			declaration = functionInitializer
+		}
+		resolver.resolveFunction(method, declaration)
+	}
+
+	resolver.endScope()
+
+	if stmt.Superclass != nil {
+		resolver.endScope()
+	}
+
+	resolver.currentClass = enclosingClass
+	return nil
+}
+
+func (resolver *Resolver) VisitExpressionStmt(stmt Expression) interface{} {
+	resolver.resolveExpr(stmt.Expression)
+	return nil
+}
+
+func (resolver *Resolver) VisitFunctionStmt(stmt Function) interface{} {
+	resolver.declare(stmt.Name)
+	resolver.define(stmt.Name)
+
+	resolver.resolveFunction(stmt, functionFunction)
+	return nil
+}
+
+func (resolver *Resolver) VisitIfStmt(stmt If) interface{} {
+	resolver.resolveExpr(stmt.Condition)
+	resolver.resolveStmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		resolver.resolveStmt(stmt.ElseBranch)
+	}
+	return nil
+}
+
+func (resolver *Resolver) VisitPrintStmt(stmt Print) interface{} {
+	resolver.resolveExpr(stmt.Expression)
+	return nil
+}
+
+func (resolver *Resolver) VisitReturnStmt(stmt Return) interface{} {
+	if resolver.currentFunction == functionNone {
+		resolver.error(stmt.Keyword, "can't return from top-level code")
+	}
+
+	if stmt.Value != nil {
+		if resolver.currentFunction == functionInitializer {
+			resolver.error(stmt.Keyword, "can't return a value from an initializer")
+		}
+		resolver.resolveExpr(stmt.Value)
+	}
+	return nil
+}
+
+func (resolver *Resolver) VisitVarStmt(stmt Var) interface{} {
+	resolver.declare(stmt.Name)
+	if stmt.Initializer != nil {
+		resolver.resolveExpr(stmt.Initializer)
+	}
+	resolver.define(stmt.Name)
+	return nil
+}
+
+func (resolver *Resolver) VisitWhileStmt(stmt While) interface{} {
+	resolver.resolveExpr(stmt.Condition)
+	resolver.resolveStmt(stmt.Body)
+	return nil
+}
+
+func (resolver *Resolver) VisitAssignExpr(expr Assign) interface{} {
+	resolver.resolveExpr(expr.Value)
+	resolver.resolveLocal(expr.Name, expr.ID)
+	return nil
+}
+
+func (resolver *Resolver) VisitBinaryExpr(expr Binary) interface{} {
+	resolver.resolveExpr(expr.Left)
+	resolver.resolveExpr(expr.Right)
+	return nil
+}
+
+func (resolver *Resolver) VisitCallExpr(expr Call) interface{} {
+	resolver.resolveExpr(expr.Callee)
+	for _, arg := range expr.Arguments {
+		resolver.resolveExpr(arg)
+	}
+	return nil
+}
+
+func (resolver *Resolver) VisitGetExpr(expr Get) interface{} {
+	resolver.resolveExpr(expr.Object)
+	return nil
+}
+
+func (resolver *Resolver) VisitGroupingExpr(expr Grouping) interface{} {
+	resolver.resolveExpr(expr.Expression)
+	return nil
+}
+
+func (resolver *Resolver) VisitLiteralExpr(expr Literal) interface{} {
+	return nil
+}
+
+func (resolver *Resolver) VisitLogicalExpr(expr Logical) interface{} {
+	resolver.resolveExpr(expr.Left)
+	resolver.resolveExpr(expr.Right)
+	return nil
+}
+
+func (resolver *Resolver) VisitSetExpr(expr Set) interface{} {
+	resolver.resolveExpr(expr.Value)
+	resolver.resolveExpr(expr.Object)
+	return nil
+}
+
+func (resolver *Resolver) VisitSuperExpr(expr Super) interface{} {
+	if resolver.currentClass == classNone {
+		resolver.error(expr.Keyword, "can't use 'super' outside of a class")
+	} else if resolver.currentClass != classSubclass {
+		resolver.error(expr.Keyword, "can't use 'super' in a class with no superclass")
+	}
+
+	resolver.resolveLocal(expr.Keyword, expr.ID)
+	return nil
+}
+
+func (resolver *Resolver) VisitThisExpr(expr This) interface{} {
+	if resolver.currentClass == classNone {
+		resolver.error(expr.Keyword, "can't use 'this' outside of a class")
+		return nil
+	}
+
+	resolver.resolveLocal(expr.Keyword, expr.ID)
+	return nil
+}
+
+func (resolver *Resolver) VisitUnaryExpr(expr Unary) interface{} {
+	resolver.resolveExpr(expr.Right)
+	return nil
+}
+
+func (resolver *Resolver) VisitVariableExpr(expr Variable) interface{} {
+	if len(resolver.scopes) > 0 {
+		if variable, declared := resolver.scopes[len(resolver.scopes)-1][expr.Name.Lexeme]; declared && !variable.defined {
+			resolver.error(expr.Name, "can't read local variable in its own initializer")
+		}
+	}
+
+	resolver.resolveLocal(expr.Name, expr.ID)
+	return nil
+}
+
+func (resolver *Resolver) resolveStmts(stmts []Stmt) {
+	for _, stmt := range stmts {
+		resolver.resolveStmt(stmt)
+	}
+}
+
+func (resolver *Resolver) resolveStmt(stmt Stmt) {
+	var v StmtVisitor = resolver
+	stmt.Accept(&v)
+}
+
+func (resolver *Resolver) resolveExpr(expr Expr) {
+	var v ExprVisitor = resolver
+	expr.Accept(&v)
+}
+
+func (resolver *Resolver) resolveFunction(function Function, functionType int) {
+	enclosingFunction := resolver.currentFunction
+	resolver.currentFunction = functionType
+
+	resolver.beginScope()
+	for _, param := range function.Params {
+		resolver.declare(param)
+		resolver.define(param)
+	}
+	resolver.resolveStmts(function.Body)
+	resolver.endScope()
+
+	resolver.currentFunction = enclosingFunction
+}
+
+// resolveLocal records how many scopes out name, used by the node with the
+// given ID, was declared and its slot, names that aren't found in any scope
+// are assumed to be global. With no Interpreter the Resolver only checks for
+// static errors
+func (resolver *Resolver) resolveLocal(name Token, id int) {
+	if resolver.Interpreter == nil {
+		return
+	}
+
+	for i := len(resolver.scopes) - 1; i >= 0; i-- {
+		if variable, declared := resolver.scopes[i][name.Lexeme]; declared {
+			resolver.Interpreter.resolve(id, Slot{
+				Depth: len(resolver.scopes) - 1 - i,
+				Index: variable.slot,
+			})
+			return
+		}
+	}
+
+	resolver.Interpreter.resolveGlobal(id)
+}
+
+func (resolver *Resolver) beginScope() {
+	resolver.scopes = append(resolver.scopes, make(map[string]scopeVar))
+}
+
+func (resolver *Resolver) endScope() {
+	resolver.scopes = resolver.scopes[:len(resolver.scopes)-1]
+}
+
+func (resolver *Resolver) declare(name Token) {
+	if len(resolver.scopes) == 0 {
+		return
+	}
+
+	scope := resolver.scopes[len(resolver.scopes)-1]
+	if _, declared := scope[name.Lexeme]; declared {
+		resolver.error(name, "a variable with this name is already declared in this scope")
+	}
+
+	scope[name.Lexeme] = scopeVar{slot: len(scope)}
+}
+
+func (resolver *Resolver) define(name Token) {
+	if len(resolver.scopes) == 0 {
+		return
+	}
+
+	scope := resolver.scopes[len(resolver.scopes)-1]
+	variable := scope[name.Lexeme]
+	variable.defined = true
+	scope[name.Lexeme] = variable
+}
+
+func (resolver *Resolver) error(token Token, message string) {
+	resolver.errors = append(resolver.errors, ParseError{
+		Token:   token,
+		Line:    token.Line,
+		Column:  token.Column,
+		Message: message,
+	})
+}
@@ -0,0 +1,143 @@
+package glox
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Runtime is the way to embed Lox in a Go program. Go code can define
+// globals and functions for scripts to use, run scripts, and read back the
+// globals they define or call the functions they declare. Everything run by
+// the same Runtime shares its globals. The zero Runtime is ready to use
+type Runtime struct {
+	// Stdout, Stderr and Stdin are the streams scripts use, as described
+	// on Interpreter. Each Runtime can have its own, so several can run at
+	// once without their output mixing
+	Stdout io.Writer
+	Stderr io.Writer
+	Stdin  io.Reader
+
+	// Reporter, if set, is sent every error Run returns as well
+	Reporter Reporter
+
+	// Sandbox, if set, decides which of the built in natives scripts get.
+	// Without one they get none, only what's given them with Define, Bind
+	// and RegisterFunc. It's read when the Runtime is first used
+	Sandbox *Sandbox
+
+	// Context, StepBudget, MaxCallDepth and MaxAllocation limit each call
+	// to Run or Call as described on Interpreter
+	Context       context.Context
+	StepBudget    int
+	MaxCallDepth  int
+	MaxAllocation int
+
+	interpreter Interpreter
+	lastID      int // LastID of the parser of the last source, the next carries on from it
+}
+
+func (rt *Runtime) init() {
+	if rt.interpreter.Globals == nil {
+		rt.interpreter.Globals = make(map[string]Value)
+		if rt.Sandbox != nil {
+			rt.Sandbox.Define(rt.interpreter.Globals)
+		}
+	}
+	rt.interpreter.Stdout = rt.Stdout
+	rt.interpreter.Stderr = rt.Stderr
+	rt.interpreter.Stdin = rt.Stdin
+	rt.interpreter.Reporter = rt.Reporter
+	rt.interpreter.Context = rt.Context
+	rt.interpreter.StepBudget = rt.StepBudget
+	rt.interpreter.MaxCallDepth = rt.MaxCallDepth
+	rt.interpreter.MaxAllocation = rt.MaxAllocation
+}
+
+// Define sets the global variable name to value
+func (rt *Runtime) Define(name string, value Value) {
+	rt.init()
+	rt.interpreter.Globals[name] = value
+}
+
+// RegisterFunc defines a global function called name that runs fn. Scripts
+// have to call it with arity arguments, and an error returned by fn stops
+// the script with a runtime error at the call
+func (rt *Runtime) RegisterFunc(name string, arity int, fn func(args []Value) (Value, error)) {
+	rt.Define(name, ObjectValue(&NativeFunction{
+		Name:   name,
+		Params: arity,
+		Function: func(intr *Interpreter, args []Value) (Value, error) {
+			return fn(args)
+		},
+	}))
+}
+
+// Run runs the Lox program in source. Syntax and resolution errors are
+// returned as ParseErrors before anything runs, otherwise the first runtime
+// error stops the program and is returned as a RuntimeError. A program
+// stopped by one of its limits returns the context's error,
+// ErrBudgetExceeded, a StackOverflowError or an AllocationError
+func (rt *Runtime) Run(source string) error {
+	rt.init()
+
+	err := rt.run(source)
+	if err != nil && rt.Reporter != nil {
+		rt.Reporter.Report(err)
+	}
+	return err
+}
+
+func (rt *Runtime) run(source string) error {
+	scanner := Scanner{
+		Source: source,
+	}
+	tokens := scanner.ScanTokens()
+
+	// Node IDs carry on from the last source so they never collide with
+	// those of functions declared by earlier sources
+	parser := Parser{
+		Tokens: tokens,
+		LastID: rt.lastID,
+	}
+	stmts, _ := parser.Parse()
+	rt.lastID = parser.LastID
+
+	if errs := append(scanner.Errors, parser.Errors...); len(errs) > 0 {
+		return ParseErrors(errs)
+	}
+
+	resolver := Resolver{
+		Interpreter: &rt.interpreter,
+	}
+	if err := resolver.Resolve(stmts); err != nil {
+		return err
+	}
+
+	return rt.interpreter.Interpret(stmts)
+}
+
+// Get returns the value of the global variable name and whether it's defined
+func (rt *Runtime) Get(name string) (Value, bool) {
+	value, defined := rt.interpreter.Globals[name]
+	return value, defined
+}
+
+// Call calls fn, a Lox function, class or native function, with args and
+// returns its result. A runtime error while it runs is returned as a
+// RuntimeError
+func (rt *Runtime) Call(fn Value, args ...Value) (result Value, err error) {
+	rt.init()
+
+	function, isCallable := fn.AsObject().(LoxCallable)
+	if !isCallable {
+		return NilValue, RuntimeError{Message: fmt.Sprintf("can only call functions and classes, not %s", fn)}
+	}
+	if len(args) != function.Arity() {
+		return NilValue, RuntimeError{Message: fmt.Sprintf("expected %v arguments but got %v", function.Arity(), len(args))}
+	}
+
+	defer recoverError(&err)
+	defer rt.interpreter.begin()()
+	return function.Call(&rt.interpreter, args), nil
+}
@@ -0,0 +1,48 @@
+package glox
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRuntimeRunsShareDeclarations(t *testing.T) {
+	var stdout bytes.Buffer
+	rt := Runtime{
+		Stdout: &stdout,
+	}
+
+	sources := []string{
+		`fun counter() { var n = 0; fun inc() { n = n + 1; return n; } return inc; }`,
+		`var c = counter(); c();`,
+		`var n = "global"; { var local = c(); print local; } print n;`,
+	}
+	for _, source := range sources {
+		if err := rt.Run(source); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := stdout.String(), "2\nglobal\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
+
+func TestRuntimeCallKeepsArgs(t *testing.T) {
+	rt := Runtime{}
+	if err := rt.Run(`fun f(a) { a = 2; var b = 3; return a + b; }`); err != nil {
+		t.Fatal(err)
+	}
+
+	f, _ := rt.Get("f")
+	args := make([]Value, 1, 2)
+	args[0] = NumberValue(1)
+	backing := args[:2]
+
+	result, err := rt.Call(f, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != NumberValue(5) || backing[0] != NumberValue(1) || backing[1] != NilValue {
+		t.Errorf("got %v with args left as %v, want 5 and [1 nil]", result, backing)
+	}
+}
@@ -0,0 +1,62 @@
+package glox
+
+import "fmt"
+
+// Capability names a set of natives a program can be given. A program can
+// only reach what its natives let it, so granting capabilities decides
+// what it can do outside of itself
+type Capability string
+
+const (
+	CAP_PURE     Capability = "pure"     // Natives with no effects, like str and sqrt
+	CAP_IO_READ  Capability = "io-read"  // Reading files and standard input
+	CAP_IO_WRITE Capability = "io-write" // Writing files
+	CAP_ENV      Capability = "env"      // Reading environment variables
+	CAP_TIME     Capability = "time"     // Reading the clock
+)
+
+// Capabilities is every capability there is
+var Capabilities = []Capability{CAP_PURE, CAP_IO_READ, CAP_IO_WRITE, CAP_ENV, CAP_TIME}
+
+// Sandbox decides which natives a program can call
+type Sandbox struct {
+	// Grant is the capabilities whose natives the program can call
+	Grant []Capability
+
+	// Hide leaves the natives of capabilities that aren't granted out of
+	// the globals altogether. Otherwise they're defined but raise a
+	// runtime error saying what capability they need when called
+	Hide bool
+}
+
+// Define adds the natives to globals as the sandbox allows
+func (sb Sandbox) Define(globals map[string]Value) {
+	granted := make(map[Capability]bool)
+	for _, capability := range sb.Grant {
+		granted[capability] = true
+	}
+
+	for name, native := range natives {
+		if granted[native.capability] {
+			globals[name] = ObjectValue(&NativeFunction{
+				Name:     name,
+				Params:   native.arity,
+				Function: native.fn,
+			})
+			continue
+		}
+
+		if sb.Hide {
+			continue
+		}
+
+		err := fmt.Errorf("%s needs the %s capability", name, native.capability)
+		globals[name] = ObjectValue(&NativeFunction{
+			Name:   name,
+			Params: native.arity,
+			Function: func(intr *Interpreter, args []Value) (Value, error) {
+				return NilValue, err
+			},
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package glox
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSandbox(t *testing.T) {
+	tests := []struct {
+		name    string
+		sandbox Sandbox
+		source  string
+		stdout  string
+		err     string // Message of the runtime error the program stops with, if any
+	}{
+		{"granted", Sandbox{Grant: []Capability{CAP_PURE}}, `print sqrt(16);`, "4\n", ""},
+		{"denied", Sandbox{Grant: []Capability{CAP_PURE}}, `print readFile("x");`, "", "readFile needs the io-read capability"},
+		{"hidden", Sandbox{Grant: []Capability{CAP_PURE}, Hide: true}, `print readFile("x");`, "", "undefined variable 'readFile'"},
+		{"none granted", Sandbox{}, `print clock();`, "", "clock needs the time capability"},
+	}
+
+	for _, test := range tests {
+		stmts := parse(t, test.source)
+		for _, backend := range backends {
+			t.Run(test.name+"/"+backend.name, func(t *testing.T) {
+				globals := make(map[string]Value)
+				test.sandbox.Define(globals)
+
+				var stdout bytes.Buffer
+				err := backend.run(stmts, options{Globals: globals, Stdout: &stdout})
+
+				if got := stdout.String(); got != test.stdout {
+					t.Errorf("printed %q, want %q", got, test.stdout)
+				}
+
+				if test.err == "" {
+					if err != nil {
+						t.Errorf("unexpected error: %v", err)
+					}
+					return
+				}
+
+				var runtimeErr RuntimeError
+				if !errors.As(err, &runtimeErr) || runtimeErr.Message != test.err {
+					t.Errorf("got error %v, want %s", err, test.err)
+				}
+			})
+		}
+	}
+}
+
+func TestSandboxHide(t *testing.T) {
+	globals := make(map[string]Value)
+	Sandbox{Grant: []Capability{CAP_PURE}, Hide: true}.Define(globals)
+
+	for name, native := range natives {
+		if _, defined := globals[name]; defined != (native.capability == CAP_PURE) {
+			t.Errorf("%s defined is %v with only %s granted", name, defined, CAP_PURE)
+		}
+	}
+}
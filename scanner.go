@@ -1,7 +1,6 @@
 package glox
 
 import (
-	"fmt"
 	"strconv"
 )
 
@@ -29,8 +28,10 @@ var Keywords = map[string]int{
 type Scanner struct {
 	Source         string
 	Tokens         []Token
+	Errors         []ParseError
 	start, current int
 	line           int
+	lineStart      int
 }
 
 func (sc *Scanner) atEnd() bool {
@@ -80,6 +81,22 @@ func (sc *Scanner) addLiteralToken(token int, literal interface{}) {
 		Lexeme:    text,
 		Literal:   literal,
 		Line:      sc.line,
+		Column:    sc.start - sc.lineStart + 1,
+	})
+}
+
+// error records a problem with the token currently being scanned
+func (sc *Scanner) error(message string) {
+	token := Token{
+		Lexeme: string([]rune(sc.Source)[sc.start:sc.current]),
+		Line:   sc.line,
+		Column: sc.start - sc.lineStart + 1,
+	}
+	sc.Errors = append(sc.Errors, ParseError{
+		Token:   token,
+		Line:    token.Line,
+		Column:  token.Column,
+		Message: message,
 	})
 }
 
@@ -87,12 +104,14 @@ func (sc *Scanner) scanStr() {
 	for sc.peek() != '"' && !sc.atEnd() { // Keep reading characters until a " is found or the end is reached
 		if sc.peek() == '\n' { // If we encounter a newline
 			sc.line++ // increase the line count
+			sc.lineStart = sc.current + 1
 		}
 		sc.advance() // Advance the scanner to the next character
 	}
 
 	if sc.atEnd() { // If we're at the end of the source then there was never a closing "
-		fmt.Printf("Unterminated string")
+		sc.error("unterminated string")
+		sc.Errors[len(sc.Errors)-1].Unterminated = true
 		return
 	}
 
@@ -215,6 +234,7 @@ func (sc *Scanner) scanToken() {
 	case '\t':
 	case '\n':
 		sc.line++
+		sc.lineStart = sc.current
 	case '"':
 		sc.scanStr()
 	default:
@@ -223,18 +243,23 @@ func (sc *Scanner) scanToken() {
 		} else if isAlphaNumeric(c) {
 			sc.scanIdentifier()
 		} else {
-			fmt.Printf("Unexpected character on line %v\n", sc.line)
+			sc.error("unexpected character")
 		}
 	}
 }
 
 // ScanTokens will scan the soruce code for tokens
 func (sc *Scanner) ScanTokens() []Token {
+	if sc.line == 0 { // Lines are numbered from 1
+		sc.line = 1
+	}
+
 	for !sc.atEnd() { // Keep reading every character until at the end of the file
 		sc.start = sc.current // The token starts at the current position
 		sc.scanToken() // Scan a token from the source
 	}
 	
+	sc.start = sc.current
 	sc.addToken(EOF) // Add en end of file token to the end
 
 	return sc.Tokens // Return the list of tokens
@@ -0,0 +1,30 @@
+package glox
+
+import "testing"
+
+func TestScannerUnterminatedString(t *testing.T) {
+	tests := []struct {
+		source       string
+		unterminated bool
+	}{
+		{`print "open`, true},
+		{"print \"open\nstill open", true},
+		{`print "closed";`, false},
+		{`print @;`, false},
+	}
+
+	for _, test := range tests {
+		scanner := Scanner{
+			Source: test.source,
+		}
+		scanner.ScanTokens()
+
+		unterminated := false
+		for _, err := range scanner.Errors {
+			unterminated = unterminated || err.Unterminated
+		}
+		if unterminated != test.unterminated {
+			t.Errorf("%q unterminated is %v, want %v", test.source, unterminated, test.unterminated)
+		}
+	}
+}
@@ -6,8 +6,12 @@ type Stmt interface {
 
 type StmtVisitor interface {
     VisitBlockStmt(Block) interface{}
+    VisitClassStmt(Class) interface{}
     VisitExpressionStmt(Expression) interface{}
+    VisitFunctionStmt(Function) interface{}
+    VisitIfStmt(If) interface{}
     VisitPrintStmt(Print) interface{}
+    VisitReturnStmt(Return) interface{}
     VisitVarStmt(Var) interface{}
     VisitWhileStmt(While) interface{}
 }
@@ -20,6 +24,17 @@ func (me Block) Accept(visitor *StmtVisitor) interface{} {
     return v.VisitBlockStmt(me)
 }
 
+type Class struct {
+    Name Token
+    Superclass *Variable
+    Methods []Function
+    ID int
+}
+func (me Class) Accept(visitor *StmtVisitor) interface{} {
+    v := *visitor
+    return v.VisitClassStmt(me)
+}
+
 type Expression struct {
     Expression Expr
 }
@@ -28,7 +43,30 @@ func (me Expression) Accept(visitor *StmtVisitor) interface{} {
     return v.VisitExpressionStmt(me)
 }
 
+type Function struct {
+    Name Token
+    Params []Token
+    Body []Stmt
+    ID int
+}
+func (me Function) Accept(visitor *StmtVisitor) interface{} {
+    v := *visitor
+    return v.VisitFunctionStmt(me)
+}
+
+type If struct {
+    Keyword Token
+    Condition Expr
+    ThenBranch Stmt
+    ElseBranch Stmt
+}
+func (me If) Accept(visitor *StmtVisitor) interface{} {
+    v := *visitor
+    return v.VisitIfStmt(me)
+}
+
 type Print struct {
+    Keyword Token
     Expression Expr
 }
 func (me Print) Accept(visitor *StmtVisitor) interface{} {
@@ -36,9 +74,19 @@ func (me Print) Accept(visitor *StmtVisitor) interface{} {
     return v.VisitPrintStmt(me)
 }
 
+type Return struct {
+    Keyword Token
+    Value Expr
+}
+func (me Return) Accept(visitor *StmtVisitor) interface{} {
+    v := *visitor
+    return v.VisitReturnStmt(me)
+}
+
 type Var struct {
     Name Token
     Initializer Expr
+    ID int
 }
 func (me Var) Accept(visitor *StmtVisitor) interface{} {
     v := *visitor
@@ -46,6 +94,7 @@ func (me Var) Accept(visitor *StmtVisitor) interface{} {
 }
 
 type While struct {
+    Keyword Token
     Condition Expr
     Body Stmt
 }
@@ -67,8 +67,25 @@ type Token struct {
 	Lexeme    string
 	Literal   interface{}
 	Line      int
+	Column    int
+}
+
+var tokenNames = []string{
+	"", "LEFT_PAREN", "RIGHT_PAREN", "LEFT_BRACE", "RIGHT_BRACE", "COMMA", "DOT", "MINUS", "PLUS", "SEMICOLON", "SLASH", "STAR", "STARSTAR",
+	"BANG", "BANG_EQUAL", "EQUAL", "EQUAL_EQUAL", "GREATER", "GREATER_EQUAL", "LESS", "LESS_EQUAL",
+	"IDENTIFIER", "STRING", "NUMBER",
+	"AND", "CLASS", "ELSE", "FALSE", "FUN", "FOR", "IF", "NIL", "OR", "PRINT", "RETURN", "SUPER", "THIS", "TRUE", "VAR", "WHILE",
+	"EOF",
+}
+
+// TokenTypeName returns the name of the token type constant, such as "LEFT_PAREN"
+func TokenTypeName(tokenType int) string {
+	if tokenType <= 0 || tokenType >= len(tokenNames) {
+		return fmt.Sprintf("%d", tokenType)
+	}
+	return tokenNames[tokenType]
 }
 
 func (token Token) String() string {
-	return fmt.Sprintf("%v\t%s\t%v", token.TokenType, token.Lexeme, token.Literal)
+	return fmt.Sprintf("%v\t%s\t%v", TokenTypeName(token.TokenType), token.Lexeme, token.Literal)
 }
@@ -0,0 +1,179 @@
+package glox
+
+import (
+	"hash/fnv"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// ValueType says what kind of value a Value holds
+type ValueType uint8
+
+const (
+	VAL_NIL ValueType = iota
+	VAL_BOOL
+	VAL_NUMBER
+	VAL_STRING
+	VAL_OBJECT
+)
+
+// Object is implemented by every runtime value that isn't a nil, boolean,
+// number or string: functions, classes, instances and so on
+type Object interface {
+	String() string
+}
+
+// Value is a Lox runtime value. The zero Value is nil
+type Value struct {
+	kind ValueType
+	num  float64     // The number, or 1 for true
+	ref  interface{} // The string or Object
+}
+
+// NilValue is the Lox nil
+var NilValue = Value{}
+
+func BoolValue(b bool) Value {
+	if b {
+		return Value{kind: VAL_BOOL, num: 1}
+	}
+	return Value{kind: VAL_BOOL}
+}
+
+func NumberValue(n float64) Value {
+	return Value{kind: VAL_NUMBER, num: n}
+}
+
+func StringValue(s string) Value {
+	return Value{kind: VAL_STRING, ref: s}
+}
+
+func ObjectValue(obj Object) Value {
+	return Value{kind: VAL_OBJECT, ref: obj}
+}
+
+func (v Value) Type() ValueType {
+	return v.kind
+}
+
+func (v Value) IsNil() bool {
+	return v.kind == VAL_NIL
+}
+
+func (v Value) IsNumber() bool {
+	return v.kind == VAL_NUMBER
+}
+
+func (v Value) IsString() bool {
+	return v.kind == VAL_STRING
+}
+
+// AsBool returns the boolean in v, or false if v isn't a boolean
+func (v Value) AsBool() bool {
+	return v.kind == VAL_BOOL && v.num != 0
+}
+
+// AsNumber returns the number in v, or 0 if v isn't a number
+func (v Value) AsNumber() float64 {
+	if v.kind != VAL_NUMBER {
+		return 0
+	}
+	return v.num
+}
+
+// AsString returns the string in v, or "" if v isn't a string
+func (v Value) AsString() string {
+	s, _ := v.ref.(string)
+	return s
+}
+
+// AsObject returns the Object in v, or nil if v isn't an object
+func (v Value) AsObject() Object {
+	obj, _ := v.ref.(Object)
+	return obj
+}
+
+// IsTruthy follows Lox rules, where only nil and false are falsey
+func (v Value) IsTruthy() bool {
+	switch v.kind {
+	case VAL_NIL:
+		return false
+	case VAL_BOOL:
+		return v.num != 0
+	}
+	return true
+}
+
+// Equal compares nil, booleans, numbers and strings by value and objects
+// by identity. Values of different types are never equal
+func (v Value) Equal(other Value) bool {
+	if v.kind != other.kind {
+		return false
+	}
+
+	switch v.kind {
+	case VAL_NIL:
+		return true
+	case VAL_BOOL, VAL_NUMBER:
+		return v.num == other.num
+	case VAL_STRING:
+		return v.ref.(string) == other.ref.(string)
+	}
+
+	if reflect.TypeOf(v.ref) != reflect.TypeOf(other.ref) || !reflect.TypeOf(v.ref).Comparable() {
+		return false
+	}
+	return v.ref == other.ref
+}
+
+// Hash returns a hash of v, values that are Equal have the same hash
+func (v Value) Hash() uint64 {
+	h := fnv.New64a()
+	h.Write([]byte{byte(v.kind)})
+
+	switch v.kind {
+	case VAL_BOOL, VAL_NUMBER:
+		num := v.num
+		if num == 0 {
+			num = 0 // -0 is equal to 0 so has to hash the same
+		}
+		bits := math.Float64bits(num)
+		h.Write([]byte{
+			byte(bits), byte(bits >> 8), byte(bits >> 16), byte(bits >> 24),
+			byte(bits >> 32), byte(bits >> 40), byte(bits >> 48), byte(bits >> 56),
+		})
+	case VAL_STRING:
+		h.Write([]byte(v.ref.(string)))
+	case VAL_OBJECT:
+		if ref := reflect.ValueOf(v.ref); ref.Kind() == reflect.Ptr {
+			pointer := uint64(ref.Pointer())
+			h.Write([]byte{
+				byte(pointer), byte(pointer >> 8), byte(pointer >> 16), byte(pointer >> 24),
+				byte(pointer >> 32), byte(pointer >> 40), byte(pointer >> 48), byte(pointer >> 56),
+			})
+		}
+	}
+	return h.Sum64()
+}
+
+// String formats the value the same way the reference Lox implementation does
+func (v Value) String() string {
+	switch v.kind {
+	case VAL_NIL:
+		return "nil"
+	case VAL_BOOL:
+		return strconv.FormatBool(v.num != 0)
+	case VAL_NUMBER:
+		if math.IsInf(v.num, 1) {
+			return "Infinity"
+		}
+		if math.IsInf(v.num, -1) {
+			return "-Infinity"
+		}
+		return strconv.FormatFloat(v.num, 'f', -1, 64)
+	case VAL_STRING:
+		return v.ref.(string)
+	}
+	return v.ref.(Object).String()
+}
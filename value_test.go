@@ -0,0 +1,74 @@
+package glox
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValueEqual(t *testing.T) {
+	a := ObjectValue(&LoxClass{Name: "A"})
+	b := ObjectValue(&LoxClass{Name: "A"})
+
+	tests := []struct {
+		x, y  Value
+		equal bool
+	}{
+		{NilValue, NilValue, true},
+		{NilValue, BoolValue(false), false},
+		{BoolValue(true), BoolValue(true), true},
+		{BoolValue(true), BoolValue(false), false},
+		{BoolValue(true), NumberValue(1), false},
+		{BoolValue(false), NumberValue(0), false},
+		{NumberValue(1), NumberValue(1), true},
+		{NumberValue(1), NumberValue(2), false},
+		{NumberValue(0), NumberValue(math.Copysign(0, -1)), true},
+		{NumberValue(math.NaN()), NumberValue(math.NaN()), false},
+		{StringValue("a"), StringValue("a"), true},
+		{StringValue("a"), StringValue("b"), false},
+		{StringValue("1"), NumberValue(1), false},
+		{StringValue(""), NilValue, false},
+		{a, a, true},
+		{a, b, false},
+		{a, NilValue, false},
+	}
+
+	for _, test := range tests {
+		if got := test.x.Equal(test.y); got != test.equal {
+			t.Errorf("%v equal to %v is %v, want %v", test.x, test.y, got, test.equal)
+		}
+		if got := test.y.Equal(test.x); got != test.equal {
+			t.Errorf("%v equal to %v is %v, want %v", test.y, test.x, got, test.equal)
+		}
+		if test.equal && test.x.Hash() != test.y.Hash() {
+			t.Errorf("%v and %v are equal but hash differently", test.x, test.y)
+		}
+	}
+}
+
+func TestValueString(t *testing.T) {
+	tests := []struct {
+		value Value
+		want  string
+	}{
+		{NilValue, "nil"},
+		{BoolValue(true), "true"},
+		{BoolValue(false), "false"},
+		{NumberValue(1), "1"},
+		{NumberValue(1.5), "1.5"},
+		{NumberValue(-2.25), "-2.25"},
+		{NumberValue(100), "100"},
+		{NumberValue(1e21), "1000000000000000000000"},
+		{NumberValue(math.Copysign(0, -1)), "-0"},
+		{NumberValue(math.NaN()), "NaN"},
+		{NumberValue(math.Inf(1)), "Infinity"},
+		{NumberValue(math.Inf(-1)), "-Infinity"},
+		{StringValue("hi"), "hi"},
+		{StringValue(""), ""},
+	}
+
+	for _, test := range tests {
+		if got := test.value.String(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
@@ -0,0 +1,594 @@
+package glox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Room the stack and frames start with, they grow as calls nest deeper
+const (
+	framesInitial = 64
+	stackInitial  = framesInitial * 8
+)
+
+// vmClosure is a CompiledFunction along with the variables it has captured
+type vmClosure struct {
+	Function *CompiledFunction
+	Upvalues []*vmUpvalue
+}
+
+func (closure *vmClosure) String() string {
+	return closure.Function.String()
+}
+
+// vmUpvalue is a variable captured by a closure. While the variable is
+// still on the stack Location points at its slot, once it goes out of scope
+// the value is moved into Closed and Location points there instead
+type vmUpvalue struct {
+	Location *Value
+	Closed   Value
+	slot     int
+	next     *vmUpvalue
+}
+
+type vmClass struct {
+	Name    string
+	Methods map[string]*vmClosure
+}
+
+func (class *vmClass) String() string {
+	return class.Name
+}
+
+type vmInstance struct {
+	Class  *vmClass
+	Fields map[string]Value
+}
+
+func (instance *vmInstance) String() string {
+	return instance.Class.Name + " instance"
+}
+
+type vmBoundMethod struct {
+	Receiver Value
+	Method   *vmClosure
+}
+
+func (bound *vmBoundMethod) String() string {
+	return bound.Method.String()
+}
+
+// callFrame is a function call in progress, slots is the index of the
+// stack slot holding the function, its arguments and locals follow
+type callFrame struct {
+	closure *vmClosure
+	ip      int
+	slots   int
+}
+
+// VM is a stack based virtual machine that runs compiled bytecode
+type VM struct {
+	Globals map[string]Value
+
+	// Stdout, Stderr and Stdin are the streams print and the natives use,
+	// and Reporter is sent the errors passed to Report, as described on
+	// Interpreter
+	Stdout   io.Writer
+	Stderr   io.Writer
+	Stdin    io.Reader
+	Reporter Reporter
+
+	// Context, StepBudget, MaxCallDepth and MaxAllocation limit each call
+	// to Interpret as described on Interpreter. OP_LOOP and calls count as
+	// steps
+	Context       context.Context
+	StepBudget    int
+	MaxCallDepth  int
+	MaxAllocation int
+
+	// Trace, if set, is sent the stack and the instruction about to run at every step
+	Trace io.Writer
+
+	stack        []Value
+	sp           int
+	frames       []callFrame
+	frameCount   int
+	openUpvalues *vmUpvalue
+	budget       *budget
+	streams      *Interpreter // Given to natives
+}
+
+// Interpret runs a function returned by Compile, stopping at and returning the first runtime error
+func (vm *VM) Interpret(function *CompiledFunction) (err error) {
+	if vm.Globals == nil {
+		vm.Globals = make(map[string]Value)
+	}
+	if vm.stack == nil {
+		vm.stack = make([]Value, stackInitial)
+		vm.frames = make([]callFrame, framesInitial)
+	}
+	vm.sp = 0
+	vm.frameCount = 0
+	vm.openUpvalues = nil
+	vm.budget = newBudget(vm.Context, vm.StepBudget, vm.MaxCallDepth, vm.MaxAllocation)
+	vm.streams = vm.newStreams()
+
+	defer recoverError(&err)
+
+	closure := &vmClosure{Function: function}
+	vm.push(ObjectValue(closure))
+	vm.call(closure, 0)
+
+	vm.run()
+	return nil
+}
+
+// Report sends err to the Reporter, or writes it to Stderr if there isn't one
+func (vm *VM) Report(err error) {
+	vm.newStreams().Report(err)
+}
+
+// newStreams returns an Interpreter with only the streams and Reporter set,
+// which is what natives and Report need of one
+func (vm *VM) newStreams() *Interpreter {
+	return &Interpreter{
+		Stdout:   vm.Stdout,
+		Stderr:   vm.Stderr,
+		Stdin:    vm.Stdin,
+		Reporter: vm.Reporter,
+	}
+}
+
+func (vm *VM) run() {
+	frame := &vm.frames[vm.frameCount-1]
+	chunk := frame.closure.Function.Chunk
+
+	for {
+		if vm.Trace != nil {
+			traceStack(vm.Trace, vm.stack[:vm.sp])
+			disassembleInstruction(vm.Trace, chunk, frame.ip)
+		}
+
+		op := chunk.Code[frame.ip]
+		frame.ip++
+
+		switch op {
+		case OP_CONSTANT:
+			vm.push(chunk.Constants[vm.readShort(frame)])
+		case OP_NIL:
+			vm.push(NilValue)
+		case OP_TRUE:
+			vm.push(BoolValue(true))
+		case OP_FALSE:
+			vm.push(BoolValue(false))
+		case OP_POP:
+			vm.sp--
+		case OP_GET_LOCAL:
+			slot := int(chunk.Code[frame.ip])
+			frame.ip++
+			vm.push(vm.stack[frame.slots+slot])
+		case OP_SET_LOCAL:
+			slot := int(chunk.Code[frame.ip])
+			frame.ip++
+			vm.stack[frame.slots+slot] = vm.peek(0)
+		case OP_GET_GLOBAL:
+			name := chunk.Constants[vm.readShort(frame)].AsString()
+			value, defined := vm.Globals[name]
+			if !defined {
+				vm.runtimeError("undefined variable '%s'", name)
+			}
+			vm.push(value)
+		case OP_DEFINE_GLOBAL:
+			name := chunk.Constants[vm.readShort(frame)].AsString()
+			vm.Globals[name] = vm.pop()
+		case OP_SET_GLOBAL:
+			name := chunk.Constants[vm.readShort(frame)].AsString()
+			if _, defined := vm.Globals[name]; !defined {
+				vm.runtimeError("undefined variable '%s'", name)
+			}
+			vm.Globals[name] = vm.peek(0)
+		case OP_GET_UPVALUE:
+			slot := chunk.Code[frame.ip]
+			frame.ip++
+			vm.push(*frame.closure.Upvalues[slot].Location)
+		case OP_SET_UPVALUE:
+			slot := chunk.Code[frame.ip]
+			frame.ip++
+			*frame.closure.Upvalues[slot].Location = vm.peek(0)
+		case OP_GET_PROPERTY:
+			name := chunk.Constants[vm.readShort(frame)].AsString()
+			if properties, hasProperties := vm.peek(0).AsObject().(PropertyObject); hasProperties {
+				vm.stack[vm.sp-1] = vm.getProperty(properties, name)
+				break
+			}
+
+			instance, isInstance := vm.peek(0).AsObject().(*vmInstance)
+			if !isInstance {
+				vm.runtimeError("only instances have properties")
+			}
+
+			if value, hasField := instance.Fields[name]; hasField {
+				vm.stack[vm.sp-1] = value
+				break
+			}
+			vm.bindMethod(instance.Class, name)
+		case OP_SET_PROPERTY:
+			name := chunk.Constants[vm.readShort(frame)].AsString()
+			if properties, hasProperties := vm.peek(1).AsObject().(PropertyObject); hasProperties {
+				if err := properties.SetProperty(name, vm.peek(0)); err != nil {
+					vm.runtimeError("%v", err)
+				}
+			} else {
+				instance, isInstance := vm.peek(1).AsObject().(*vmInstance)
+				if !isInstance {
+					vm.runtimeError("only instances have fields")
+				}
+				if _, hasField := instance.Fields[name]; !hasField {
+					vm.budget.allocate(vm.errorToken(), fieldSize)
+				}
+				instance.Fields[name] = vm.peek(0)
+			}
+
+			value := vm.pop()
+			vm.stack[vm.sp-1] = value
+		case OP_GET_SUPER:
+			name := chunk.Constants[vm.readShort(frame)].AsString()
+			superclass := vm.pop().AsObject().(*vmClass)
+			vm.bindMethod(superclass, name)
+		case OP_EQUAL:
+			b := vm.pop()
+			vm.stack[vm.sp-1] = BoolValue(vm.stack[vm.sp-1].Equal(b))
+		case OP_GREATER:
+			a, b := vm.numberOperands()
+			vm.push(BoolValue(a > b))
+		case OP_GREATER_EQUAL:
+			a, b := vm.numberOperands()
+			vm.push(BoolValue(a >= b))
+		case OP_LESS:
+			a, b := vm.numberOperands()
+			vm.push(BoolValue(a < b))
+		case OP_LESS_EQUAL:
+			a, b := vm.numberOperands()
+			vm.push(BoolValue(a <= b))
+		case OP_ADD:
+			a, b := vm.peek(1), vm.peek(0)
+			if a.IsNumber() && b.IsNumber() {
+				vm.sp -= 2
+				vm.push(NumberValue(a.AsNumber() + b.AsNumber()))
+				break
+			}
+
+			if a.IsString() && b.IsString() {
+				s := a.AsString() + b.AsString()
+				vm.budget.allocate(vm.errorToken(), stringSize+len(s))
+				vm.sp -= 2
+				vm.push(StringValue(s))
+				break
+			}
+
+			vm.runtimeError("operands must be two numbers or two strings")
+		case OP_SUBTRACT:
+			a, b := vm.numberOperands()
+			vm.push(NumberValue(a - b))
+		case OP_MULTIPLY:
+			a, b := vm.numberOperands()
+			vm.push(NumberValue(a * b))
+		case OP_DIVIDE:
+			a, b := vm.numberOperands()
+			vm.push(NumberValue(a / b))
+		case OP_POWER:
+			a, b := vm.numberOperands()
+			vm.push(NumberValue(math.Pow(a, b)))
+		case OP_NOT:
+			vm.stack[vm.sp-1] = BoolValue(!vm.stack[vm.sp-1].IsTruthy())
+		case OP_NEGATE:
+			if !vm.peek(0).IsNumber() {
+				vm.runtimeError("operand must be a number")
+			}
+			vm.stack[vm.sp-1] = NumberValue(-vm.peek(0).AsNumber())
+		case OP_PRINT:
+			fmt.Fprintln(vm.streams.stdout(), vm.pop())
+		case OP_JUMP:
+			offset := vm.readShort(frame)
+			frame.ip += offset
+		case OP_JUMP_IF_FALSE:
+			offset := vm.readShort(frame)
+			if !vm.peek(0).IsTruthy() {
+				frame.ip += offset
+			}
+		case OP_LOOP:
+			offset := vm.readShort(frame)
+			frame.ip -= offset
+			vm.budget.step()
+		case OP_CALL:
+			argCount := int(chunk.Code[frame.ip])
+			frame.ip++
+			vm.callValue(vm.peek(argCount), argCount)
+			frame = &vm.frames[vm.frameCount-1]
+			chunk = frame.closure.Function.Chunk
+		case OP_INVOKE:
+			name := chunk.Constants[vm.readShort(frame)].AsString()
+			argCount := int(chunk.Code[frame.ip])
+			frame.ip++
+			vm.invoke(name, argCount)
+			frame = &vm.frames[vm.frameCount-1]
+			chunk = frame.closure.Function.Chunk
+		case OP_SUPER_INVOKE:
+			name := chunk.Constants[vm.readShort(frame)].AsString()
+			argCount := int(chunk.Code[frame.ip])
+			frame.ip++
+			superclass := vm.pop().AsObject().(*vmClass)
+			vm.invokeFromClass(superclass, name, argCount)
+			frame = &vm.frames[vm.frameCount-1]
+			chunk = frame.closure.Function.Chunk
+		case OP_CLOSURE:
+			function := chunk.Constants[vm.readShort(frame)].AsObject().(*CompiledFunction)
+			closure := &vmClosure{
+				Function: function,
+				Upvalues: make([]*vmUpvalue, function.UpvalueCount),
+			}
+			for i := range closure.Upvalues {
+				isLocal := chunk.Code[frame.ip]
+				index := int(chunk.Code[frame.ip+1])
+				frame.ip += 2
+				if isLocal == 1 {
+					closure.Upvalues[i] = vm.captureUpvalue(frame.slots + index)
+				} else {
+					closure.Upvalues[i] = frame.closure.Upvalues[index]
+				}
+			}
+			vm.push(ObjectValue(closure))
+		case OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(vm.sp - 1)
+			vm.sp--
+		case OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.slots)
+			vm.frameCount--
+			if vm.frameCount == 0 {
+				vm.sp = 0
+				return
+			}
+
+			vm.sp = frame.slots
+			vm.push(result)
+			frame = &vm.frames[vm.frameCount-1]
+			chunk = frame.closure.Function.Chunk
+		case OP_CLASS:
+			name := chunk.Constants[vm.readShort(frame)].AsString()
+			vm.push(ObjectValue(&vmClass{
+				Name:    name,
+				Methods: make(map[string]*vmClosure),
+			}))
+		case OP_INHERIT:
+			superclass, isClass := vm.peek(1).AsObject().(*vmClass)
+			if !isClass {
+				vm.runtimeError("superclass must be a class")
+			}
+
+			// Methods are copied down now, so they never have to be looked up through the superclass
+			subclass := vm.peek(0).AsObject().(*vmClass)
+			for name, method := range superclass.Methods {
+				subclass.Methods[name] = method
+			}
+			vm.sp--
+		case OP_METHOD:
+			name := chunk.Constants[vm.readShort(frame)].AsString()
+			method := vm.peek(0).AsObject().(*vmClosure)
+			class := vm.peek(1).AsObject().(*vmClass)
+			class.Methods[name] = method
+			vm.sp--
+		}
+	}
+}
+
+func (vm *VM) push(value Value) {
+	if vm.sp == len(vm.stack) {
+		vm.growStack()
+	}
+	vm.stack[vm.sp] = value
+	vm.sp++
+}
+
+// growStack doubles the size of the stack, moving the open upvalues to
+// point into the new one
+func (vm *VM) growStack() {
+	stack := make([]Value, 2*len(vm.stack))
+	copy(stack, vm.stack)
+	vm.stack = stack
+	for upvalue := vm.openUpvalues; upvalue != nil; upvalue = upvalue.next {
+		upvalue.Location = &vm.stack[upvalue.slot]
+	}
+}
+
+func (vm *VM) pop() Value {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) peek(distance int) Value {
+	return vm.stack[vm.sp-1-distance]
+}
+
+func (vm *VM) readShort(frame *callFrame) int {
+	value := frame.closure.Function.Chunk.readShort(frame.ip)
+	frame.ip += 2
+	return value
+}
+
+// numberOperands pops the two operands of a binary operator, raising an error unless they are numbers
+func (vm *VM) numberOperands() (float64, float64) {
+	a, b := vm.peek(1), vm.peek(0)
+	if !a.IsNumber() || !b.IsNumber() {
+		vm.runtimeError("operands must be numbers")
+	}
+	vm.sp -= 2
+	return a.AsNumber(), b.AsNumber()
+}
+
+func (vm *VM) callValue(callee Value, argCount int) {
+	switch callee := callee.AsObject().(type) {
+	case *vmClosure:
+		vm.call(callee, argCount)
+		return
+	case *vmBoundMethod:
+		vm.stack[vm.sp-argCount-1] = callee.Receiver
+		vm.call(callee.Method, argCount)
+		return
+	case *vmClass:
+		vm.budget.allocate(vm.errorToken(), instanceSize)
+		vm.stack[vm.sp-argCount-1] = ObjectValue(&vmInstance{
+			Class:  callee,
+			Fields: make(map[string]Value),
+		})
+		if initializer, hasInit := callee.Methods["init"]; hasInit {
+			vm.call(initializer, argCount)
+		} else if argCount != 0 {
+			vm.runtimeError("expected 0 arguments but got %v", argCount)
+		}
+		return
+	case *NativeFunction:
+		if argCount != callee.Arity() {
+			vm.runtimeError("expected %v arguments but got %v", callee.Arity(), argCount)
+		}
+		vm.budget.step()
+		args := make([]Value, argCount)
+		copy(args, vm.stack[vm.sp-argCount:vm.sp])
+		result, err := callee.Function(vm.streams, args)
+		if err != nil {
+			panic(nativeError(vm.errorToken(), err))
+		}
+		vm.sp -= argCount + 1
+		vm.push(result)
+		return
+	}
+
+	vm.runtimeError("can only call functions and classes")
+}
+
+func (vm *VM) call(closure *vmClosure, argCount int) {
+	if argCount != closure.Function.Arity {
+		vm.runtimeError("expected %v arguments but got %v", closure.Function.Arity, argCount)
+	}
+	vm.budget.step()
+	// The script's own frame isn't a call, so frameCount is one more than
+	// how deeply calls are nested
+	if vm.frameCount > vm.budget.maxDepth {
+		panic(stopError{StackOverflowError{RuntimeError{vm.errorToken(), "stack overflow"}}})
+	}
+
+	if vm.frameCount == len(vm.frames) {
+		vm.frames = append(vm.frames, callFrame{})
+		vm.frames = vm.frames[:cap(vm.frames)]
+	}
+	frame := &vm.frames[vm.frameCount]
+	vm.frameCount++
+	frame.closure = closure
+	frame.ip = 0
+	frame.slots = vm.sp - argCount - 1
+}
+
+func (vm *VM) invoke(name string, argCount int) {
+	if properties, hasProperties := vm.peek(argCount).AsObject().(PropertyObject); hasProperties {
+		value := vm.getProperty(properties, name)
+		vm.stack[vm.sp-argCount-1] = value
+		vm.callValue(value, argCount)
+		return
+	}
+
+	instance, isInstance := vm.peek(argCount).AsObject().(*vmInstance)
+	if !isInstance {
+		vm.runtimeError("only instances have properties")
+	}
+
+	if value, hasField := instance.Fields[name]; hasField {
+		vm.stack[vm.sp-argCount-1] = value
+		vm.callValue(value, argCount)
+		return
+	}
+
+	vm.invokeFromClass(instance.Class, name, argCount)
+}
+
+// getProperty reads a property of an object from Go
+func (vm *VM) getProperty(properties PropertyObject, name string) Value {
+	value, err := properties.GetProperty(name)
+	if err != nil {
+		vm.runtimeError("%v", err)
+	}
+	return value
+}
+
+func (vm *VM) invokeFromClass(class *vmClass, name string, argCount int) {
+	method, hasMethod := class.Methods[name]
+	if !hasMethod {
+		vm.runtimeError("undefined property '%s'", name)
+	}
+	vm.call(method, argCount)
+}
+
+// bindMethod replaces the instance on top of the stack with its method name bound to it
+func (vm *VM) bindMethod(class *vmClass, name string) {
+	method, hasMethod := class.Methods[name]
+	if !hasMethod {
+		vm.runtimeError("undefined property '%s'", name)
+	}
+
+	vm.stack[vm.sp-1] = ObjectValue(&vmBoundMethod{
+		Receiver: vm.peek(0),
+		Method:   method,
+	})
+}
+
+// captureUpvalue returns the upvalue for a stack slot, reusing an existing
+// one so closures capturing the same variable share it
+func (vm *VM) captureUpvalue(slot int) *vmUpvalue {
+	var prev *vmUpvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		prev = upvalue
+		upvalue = upvalue.next
+	}
+
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+
+	created := &vmUpvalue{
+		Location: &vm.stack[slot],
+		slot:     slot,
+		next:     upvalue,
+	}
+	if prev == nil {
+		vm.openUpvalues = created
+	} else {
+		prev.next = created
+	}
+	return created
+}
+
+// closeUpvalues moves every captured variable at or above slot off the stack
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= last {
+		upvalue := vm.openUpvalues
+		upvalue.Closed = *upvalue.Location
+		upvalue.Location = &upvalue.Closed
+		vm.openUpvalues = upvalue.next
+	}
+}
+
+func (vm *VM) runtimeError(format string, args ...interface{}) {
+	panic(RuntimeError{
+		Token:   vm.errorToken(),
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// errorToken returns a token for the line of the instruction being run, the
+// VM has no other tokens to give errors
+func (vm *VM) errorToken() Token {
+	frame := &vm.frames[vm.frameCount-1]
+	return Token{Line: frame.closure.Function.Chunk.Lines[frame.ip-1]}
+}